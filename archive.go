@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveEntry is a file or directory stored in an archive
+type archiveEntry struct {
+	name    string // Slash-separated path inside the archive
+	size    int64  // Uncompressed
+	modTime time.Time
+	isDir   bool
+}
+
+// archiveFormat returns the format of the archive named name by its
+// extension, "zip", "tar" or "tar.gz", or "" if it isn't one -into-archives reads
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// readArchive lists the entries of the archive file node as its
+// children, with their uncompressed sizes. The children are virtual:
+// their paths lead into the archive, not to anything on disk. The
+// archive itself keeps its size on disk in its parent's totals.
+func (s *scanner) readArchive(ctx context.Context, node *FileInfo, format string) error {
+	var entries []archiveEntry
+	var err error
+	switch format {
+	case "zip":
+		entries, err = listZip(node.Path)
+	case "tar":
+		entries, err = listTarFile(ctx, node.Path, false)
+	case "tar.gz":
+		entries, err = listTarFile(ctx, node.Path, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Directories are created as entries below them need them, since
+	// archives don't always store them
+	dirs := map[string]*FileInfo{"": node}
+	var dirFor func(name string) *FileInfo
+	dirFor = func(name string) *FileInfo {
+		if dir, ok := dirs[name]; ok {
+			return dir
+		}
+		dir := s.archiveChild(dirFor(archiveParent(name)), path.Base(name))
+		dir.IsDir = true
+		dirs[name] = dir
+		return dir
+	}
+	for _, entry := range entries {
+		// Keep paths such as ../x or /x inside the archive
+		name := strings.Trim(path.Clean("/"+entry.name), "/")
+		if name == "" {
+			continue
+		}
+		if entry.isDir {
+			dir := dirFor(name)
+			dir.ModTime = entry.modTime
+			continue
+		}
+		file := s.archiveChild(dirFor(archiveParent(name)), path.Base(name))
+		file.Size = entry.size
+		file.ModTime = entry.modTime
+		file.Newest = entry.modTime
+	}
+
+	size := node.Size
+	s.totalArchive(node)
+	node.IsArchive = true
+	node.ArchiveSize = node.Size
+	node.Size = size
+	node.Newest = node.ModTime
+	return nil
+}
+
+// archiveParent returns the path of the directory holding the archive
+// entry name, "" for the top of the archive
+func archiveParent(name string) string {
+	if parent := path.Dir(name); parent != "." {
+		return parent
+	}
+	return ""
+}
+
+// archiveChild adds an entry named name of an archive to dir
+func (s *scanner) archiveChild(dir *FileInfo, name string) *FileInfo {
+	child := &FileInfo{
+		Name:      name,
+		Path:      filepath.Join(dir.Path, name),
+		InArchive: true,
+	}
+	child.OutPath = child.Path
+	if s.opts.Relative {
+		child.OutPath = path.Join(dir.OutPath, name)
+	}
+	dir.Children = append(dir.Children, child)
+	return child
+}
+
+// totalArchive sums the sizes, counts and newest changes of the entries
+// below dir, an archive or a directory in one, into it
+func (s *scanner) totalArchive(dir *FileInfo) {
+	dir.Size, dir.Count, dir.DirCount = 0, 0, 0
+	for _, child := range dir.Children {
+		if child.IsDir {
+			s.totalArchive(child)
+			dir.Count += child.Count
+			dir.DirCount += 1 + child.DirCount
+		} else {
+			dir.Count++
+		}
+		dir.Size += child.Size
+		if child.Newest.After(dir.Newest) {
+			dir.Newest = child.Newest
+		}
+	}
+	if dir.Newest.IsZero() {
+		dir.Newest = dir.ModTime
+	}
+}
+
+// listZip returns the entries of the zip file at name
+func listZip(name string) ([]archiveEntry, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	entries := make([]archiveEntry, 0, len(r.File))
+	for _, f := range r.File {
+		entries = append(entries, archiveEntry{
+			name:    f.Name,
+			size:    int64(f.UncompressedSize64),
+			modTime: f.Modified,
+			isDir:   f.FileInfo().IsDir(),
+		})
+	}
+	return entries, nil
+}
+
+// listTarFile returns the entries of the tar file at name, gzipped if
+// compressed is set. Links and special files are left out, as they hold
+// no data of their own.
+func listTarFile(ctx context.Context, name string, compressed bool) ([]archiveEntry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var entries []archiveEntry
+	tr := tar.NewReader(r)
+	for {
+		// Getting to the next header means reading through the data
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch mode := header.FileInfo().Mode(); {
+		case mode.IsDir():
+			entries = append(entries, archiveEntry{name: header.Name, modTime: header.ModTime, isDir: true})
+		case mode.IsRegular():
+			entries = append(entries, archiveEntry{name: header.Name, size: header.Size, modTime: header.ModTime})
+		}
+	}
+}
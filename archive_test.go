@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchivePercentages(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, size := range map[string]int{"a.txt": 3000, "b.txt": 1000} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(strings.Repeat("x", size)))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data.zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, IntoArchives: true})
+	archive := child(t, root, "data.zip")
+	if !archive.IsArchive || archive.ArchiveSize != 4000 || archive.Size == archive.ArchiveSize {
+		t.Fatalf("archive of %d B with %d B uncompressed", archive.Size, archive.ArchiveSize)
+	}
+	// The entries are shares of the uncompressed size, in the text tree
+	// and the JSON the HTML page is built from
+	entries := convertToJSON(root, SizeFormat{}).Children[0].Children
+	for _, entry := range entries {
+		want := float64(entry.Size) / 4000 * 100
+		if math.Abs(entry.PercentOfParent-want) > 1e-9 {
+			t.Errorf("%s: percentOfParent %.2f, want %.2f", entry.Name, entry.PercentOfParent, want)
+		}
+	}
+
+	var page strings.Builder
+	if err := generateHTML(&page, []*FileInfo{root}, dir, HTMLOptions{Theme: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"data.isArchive ? (data.archiveSize || 0) : data.size",
+		"renderTree(data.children[i], childrenContainer, newPrefix, isChildLast, childrenTotal(data))",
+	} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("the page doesn't size an archive's entries against archiveSize, lacks %q", want)
+		}
+	}
+}
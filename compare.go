@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// pairNode is a path in the merged trees of -compare, with its entry in
+// tree A, tree B or both
+type pairNode struct {
+	name     string
+	a, b     *FileInfo // nil where the path doesn't exist
+	children []*pairNode
+	differs  bool // The path or something below it isn't the same in both
+}
+
+// compareStats sums up how two trees differ
+type compareStats struct {
+	onlyA, onlyB int   // Files found in one tree only
+	changed      int   // Entries found in both with different sizes
+	differing    int64 // Bytes in one tree only, plus the size changes
+}
+
+// entryFiles returns the number of files node stands for
+func entryFiles(node *FileInfo) int {
+	if node.IsDir {
+		return node.Count
+	}
+	return 1
+}
+
+// mergeTrees pairs a and b, either of which may be nil, and their
+// descendants by name. Children keep the order of their tree, A's first,
+// then the entries only in B. A file and a directory of the same name
+// are different entries.
+func mergeTrees(name string, a, b *FileInfo, stats *compareStats) *pairNode {
+	node := &pairNode{name: name, a: a, b: b}
+	switch {
+	case b == nil:
+		node.differs = true
+		stats.onlyA += entryFiles(a)
+		stats.differing += a.Size
+		return node
+	case a == nil:
+		node.differs = true
+		stats.onlyB += entryFiles(b)
+		stats.differing += b.Size
+		return node
+	}
+
+	// Directories whose contents weren't kept can only be compared by size
+	if !a.IsDir || a.Summarized || b.Summarized || len(a.Children) == 0 && len(b.Children) == 0 {
+		if a.Size != b.Size {
+			node.differs = true
+			stats.changed++
+			stats.differing += abs(b.Size - a.Size)
+		}
+		return node
+	}
+
+	inB := make(map[string]*FileInfo, len(b.Children))
+	for _, child := range b.Children {
+		inB[child.Name] = child
+	}
+	paired := make(map[*FileInfo]bool)
+	for _, child := range a.Children {
+		other := inB[child.Name]
+		if other != nil && other.IsDir != child.IsDir {
+			other = nil
+		}
+		if other != nil {
+			paired[other] = true
+		}
+		node.children = append(node.children, mergeTrees(child.Name, child, other, stats))
+	}
+	for _, child := range b.Children {
+		if !paired[child] {
+			node.children = append(node.children, mergeTrees(child.Name, nil, child, stats))
+		}
+	}
+	for _, child := range node.children {
+		node.differs = node.differs || child.differs
+	}
+	return node
+}
+
+// printCompare prints the trees a and b, named nameA and nameB, merged
+// into one. Each line is marked - when only in A, + when only in B, ~
+// when its size differs or something below it does, and left unmarked
+// when the same in both. Directories only in one tree or the same in
+// both are listed without their contents. A summary of the differences
+// ends the output.
+func printCompare(w io.Writer, a, b *FileInfo, nameA, nameB string, style treeStyle, f SizeFormat) {
+	var stats compareStats
+	root := mergeTrees(nameA+" vs "+nameB, a, b, &stats)
+	printPair(w, root, nil, "", true, style, f)
+
+	fmt.Fprintf(w, "\nTotal differing: %s (%s only in %s, %s only in %s, %s changed)\n",
+		formatSize(stats.differing, f), pluralize(stats.onlyA, "file"), nameA,
+		pluralize(stats.onlyB, "file"), nameB, pluralizeCount(stats.changed, "entry", "entries"))
+}
+
+// printPair prints node and, when it differs, its children below prefix
+// like printFileTree
+func printPair(w io.Writer, node *pairNode, parent *pairNode, prefix string, isLast bool, style treeStyle, f SizeFormat) {
+	connector := ""
+	if parent != nil && isLast {
+		connector = style.lastBranch
+	} else if parent != nil {
+		connector = style.branch
+	}
+
+	marker := " "
+	entry := node.a
+	var sizes string
+	switch {
+	case node.b == nil:
+		marker = "-"
+		sizes = formatSize(node.a.Size, f)
+	case node.a == nil:
+		marker = "+"
+		entry = node.b
+		sizes = formatSize(node.b.Size, f)
+	case node.a.Size != node.b.Size:
+		marker = "~"
+		sizes = fmt.Sprintf("%s -> %s, %s", formatSize(node.a.Size, f), formatSize(node.b.Size, f),
+			formatSizeDelta(node.b.Size-node.a.Size, f))
+	default:
+		if node.differs {
+			marker = "~" // Same total, but not the same contents
+		}
+		sizes = formatSize(node.a.Size, f)
+	}
+	name := node.name
+	if entry.IsDir && parent != nil {
+		name += "/"
+	}
+	if entry.IsDir {
+		if node.a == nil || node.b == nil {
+			sizes += ", " + pluralize(entry.Count, "file")
+		}
+	}
+	fmt.Fprintf(w, "%s %s%s%s (%s)\n", marker, prefix, connector, name, sizes)
+
+	if !node.differs {
+		return
+	}
+	newPrefix := prefix + style.indent
+	if isLast {
+		newPrefix = prefix + style.lastIndent
+	}
+	for i, child := range node.children {
+		printPair(w, child, node, newPrefix, i == len(node.children)-1, style, f)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// configFileName is the file flag defaults are read from, in the home
+// directory and in the target directory
+const configFileName = ".filesizerc"
+
+// configFlags are the flags a config file may set. Those naming files to
+// write or changing what is read are left out, since scanning a directory
+// shouldn't let a .filesizerc in it overwrite files or follow links out.
+var configFlags = map[string]bool{
+	"sort":      true,
+	"reverse":   true,
+	"unit":      true,
+	"si":        true,
+	"iec":       true,
+	"precision": true,
+	"exclude":   true,
+	"color":     true,
+}
+
+// configFiles returns the config files that apply to a scan of target,
+// lowest precedence first: the one in the home directory, then the one
+// in target if it is a directory
+func configFiles(target string) []string {
+	var files []string
+	home, err := os.UserHomeDir()
+	if err == nil {
+		files = append(files, filepath.Join(home, configFileName))
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		// Scanning the home directory reads its file only once
+		if file, err := filepath.Abs(filepath.Join(target, configFileName)); err == nil && !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// applyConfig sets the flags named in files, which don't have to exist.
+// Flags given on the command line keep their value. Later files
+// override earlier ones, except that repeatable flags such as exclude
+// collect the values of all of them.
+func applyConfig(files []string) error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, file := range files {
+		if err := applyConfigFile(file, explicit); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigFile sets the flags named in file that aren't explicit.
+// Each line holds a flag name without its dash, =, and the value, e.g.
+// sort=size or exclude=node_modules, or only the name of a boolean flag
+// to turn it on. Only configFlags can be set. Blank lines and lines
+// starting with # are ignored.
+func applyConfigFile(file string, explicit map[string]bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		target := flag.Lookup(name)
+		if target == nil {
+			return fmt.Errorf("%s:%d: unknown option '%s'", file, line, name)
+		}
+		if !configFlags[name] {
+			return fmt.Errorf("%s:%d: option '%s' can't be set in a config file", file, line, name)
+		}
+		if !ok {
+			if b, isBool := target.Value.(interface{ IsBoolFlag() bool }); !isBool || !b.IsBoolFlag() {
+				return fmt.Errorf("%s:%d: expected %s=value", file, line, name)
+			}
+			value = "true"
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value '%s' for %s: %v", file, line, value, name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
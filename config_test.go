@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"small": "x", "big": "xxx"})
+	rc := filepath.Join(dir, configFileName)
+	written := filepath.Join(t.TempDir(), "pwned.txt")
+
+	tests := []struct {
+		config string
+		status int
+		want   string // In the output, or the error for status 1
+	}{
+		{"# sort by size\nsort=size\nexclude = small\nexclude=" + configFileName + "\n", 0, "    └── big (3 B)\n"},
+		{"sort=size\nreverse\nexclude=" + configFileName + "\n", 0, "    ├── small (1 B)\n    └── big (3 B)\n"},
+		{"output=" + written + "\n", 1, "option 'output' can't be set in a config file"},
+		{"sort=size\nhtml=" + written + "\n", 1, "option 'html' can't be set in a config file"},
+		{"follow\n", 1, "option 'follow' can't be set in a config file"},
+		{"nonsense=1\n", 1, "unknown option 'nonsense'"},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(rc, []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stdout, stderr, status := runFilesize(t, "", dir)
+		if status != tt.status {
+			t.Errorf("%q: exit status %d, want %d; stderr:\n%s", tt.config, status, tt.status, stderr)
+		}
+		got := stdout
+		if tt.status != 0 {
+			got = stderr
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("%q: got\n%s\nwant it to contain\n%s", tt.config, got, tt.want)
+		}
+	}
+	if _, err := os.Stat(written); err == nil {
+		t.Errorf("a config file in the scanned directory wrote %s", written)
+	}
+}
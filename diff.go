@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// diffEntry is the size of one path in a scan being compared
+type diffEntry struct {
+	size  int64
+	isDir bool
+}
+
+// sizeChange is a path whose size differs between the baseline and the
+// current scan
+type sizeChange struct {
+	path     string
+	isDir    bool
+	old, new int64
+}
+
+func (c sizeChange) delta() int64 {
+	return c.new - c.old
+}
+
+// saveScan writes the full trees as JSON, in the format of -json, so a
+// later run can compare against them with -diff
+func saveScan(roots []*FileInfo, outputFile string, f SizeFormat, opts JSONOptions) error {
+	jsonRoots := make([]*JSONFileInfo, len(roots))
+	for i, root := range roots {
+		jsonRoots[i] = convertToJSON(root, f)
+	}
+	jsonBytes, err := marshalRoots(jsonRoots, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputFile, append(jsonBytes, '\n'), 0644)
+}
+
+// loadScan reads trees written by -save or -json: a JSONDocument, or
+// with -legacy-json a root object or an array of roots
+func loadScan(inputFile string) ([]*JSONFileInfo, error) {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	var roots []*JSONFileInfo
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &roots)
+	} else {
+		// Legacy root objects have no version, and their fields land in
+		// neither root nor roots
+		var doc JSONDocument
+		if err = json.Unmarshal(data, &doc); err == nil {
+			switch {
+			case doc.Version > jsonVersion:
+				return nil, fmt.Errorf("%s was saved in JSON version %d, newer than the supported %d", inputFile, doc.Version, jsonVersion)
+			case doc.Version == 0:
+				var root JSONFileInfo
+				err = json.Unmarshal(data, &root)
+				roots = []*JSONFileInfo{&root}
+			case doc.Root != nil:
+				roots = []*JSONFileInfo{doc.Root}
+			default:
+				roots = doc.Roots
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a saved scan: %w", inputFile, err)
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("%s is not a saved scan: it holds no trees", inputFile)
+	}
+	return roots, nil
+}
+
+// diffKey returns the path a scan entry is compared by: relative to its
+// root, prefixed with the root's name when several roots were scanned
+func diffKey(rootName, rootPath, nodePath string, multi bool) string {
+	key := relativePath(rootPath, nodePath)
+	if multi {
+		key = path.Join(rootName, key)
+	}
+	return key
+}
+
+// flattenScan adds a saved node and its descendants to entries
+func flattenScan(node *JSONFileInfo, root *JSONFileInfo, multi bool, entries map[string]diffEntry) {
+	entries[diffKey(root.Name, root.Path, node.Path, multi)] = diffEntry{size: node.Size, isDir: node.IsDir}
+	for _, child := range node.Children {
+		flattenScan(child, root, multi, entries)
+	}
+}
+
+// flattenTree adds node and its descendants to entries, leaving out the
+// contents of summarized directories like the saved JSON does
+func flattenTree(node *FileInfo, root *FileInfo, multi bool, entries map[string]diffEntry) {
+	entries[diffKey(root.Name, root.Path, node.Path, multi)] = diffEntry{size: node.Size, isDir: node.IsDir}
+	if node.Summarized {
+		return
+	}
+	for _, child := range node.Children {
+		flattenTree(child, root, multi, entries)
+	}
+}
+
+// printDiff compares the current trees with a saved baseline and prints
+// the paths that were added, removed, grew or shrank, biggest changes
+// first. Added and removed directories are listed without their contents.
+func printDiff(w io.Writer, baseline []*JSONFileInfo, roots []*FileInfo, f SizeFormat) {
+	before := make(map[string]diffEntry)
+	for _, root := range baseline {
+		flattenScan(root, root, len(baseline) > 1, before)
+	}
+	after := make(map[string]diffEntry)
+	for _, root := range roots {
+		flattenTree(root, root, len(roots) > 1, after)
+	}
+
+	var added, removed, grown, shrunk []sizeChange
+	for key, cur := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			if onlyIn(after, before, path.Dir(key)) {
+				continue // Listed with its new parent directory
+			}
+			added = append(added, sizeChange{path: key, isDir: cur.isDir, new: cur.size})
+		case cur.size > old.size:
+			grown = append(grown, sizeChange{path: key, isDir: cur.isDir, old: old.size, new: cur.size})
+		case cur.size < old.size:
+			shrunk = append(shrunk, sizeChange{path: key, isDir: cur.isDir, old: old.size, new: cur.size})
+		}
+	}
+	for key, old := range before {
+		if _, ok := after[key]; ok {
+			continue
+		}
+		if onlyIn(before, after, path.Dir(key)) {
+			continue // Listed with its removed parent directory
+		}
+		removed = append(removed, sizeChange{path: key, isDir: old.isDir, old: old.size})
+	}
+
+	printChanges(w, "Added", added, false, f)
+	printChanges(w, "Removed", removed, false, f)
+	printChanges(w, "Grown", grown, true, f)
+	printChanges(w, "Shrunk", shrunk, true, f)
+
+	var oldTotal, newTotal int64
+	for _, root := range baseline {
+		oldTotal += root.Size
+	}
+	for _, root := range roots {
+		newTotal += root.Size
+	}
+	fmt.Fprintf(w, "Total: %s -> %s (%s)\n", formatSize(oldTotal, f), formatSize(newTotal, f),
+		formatSizeDelta(newTotal-oldTotal, f))
+}
+
+// onlyIn reports whether key is a path of scan a but not of scan b
+func onlyIn(a, b map[string]diffEntry, key string) bool {
+	_, inA := a[key]
+	_, inB := b[key]
+	return inA && !inB
+}
+
+// printChanges prints a titled section of changes, largest first, or
+// nothing when there are none. showSizes adds the old and new sizes.
+func printChanges(w io.Writer, title string, changes []sizeChange, showSizes bool, f SizeFormat) {
+	if len(changes) == 0 {
+		return
+	}
+	slices.SortFunc(changes, func(a, b sizeChange) int {
+		if c := cmp.Compare(abs(b.delta()), abs(a.delta())); c != 0 {
+			return c
+		}
+		return strings.Compare(a.path, b.path)
+	})
+
+	fmt.Fprintf(w, "%s (%d):\n", title, len(changes))
+	for _, change := range changes {
+		name := change.path
+		if change.isDir {
+			name += "/"
+		}
+		if showSizes {
+			name += fmt.Sprintf(" (%s -> %s)", formatSize(change.old, f), formatSize(change.new, f))
+		}
+		fmt.Fprintf(w, "  %12s  %s\n", formatSizeDelta(change.delta(), f), name)
+	}
+	fmt.Fprintln(w)
+}
+
+// formatSizeDelta formats a size change with an explicit sign
+func formatSizeDelta(delta int64, f SizeFormat) string {
+	if delta < 0 {
+		return "-" + formatSize(-delta, f)
+	}
+	return "+" + formatSize(delta, f)
+}
+
+// abs returns the absolute value of n
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffBaseline(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"old.txt": "x"})
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	if _, stderr, status := runFilesize(t, "", "-save", baseline, dir); status != 0 {
+		t.Fatalf("-save: exit status %d, stderr:\n%s", status, stderr)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("xyz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, _, status := runFilesize(t, "", "-diff", baseline, dir)
+	if status != 0 || !strings.Contains(diff, "new.txt") {
+		t.Fatalf("-diff: exit status %d, output:\n%s", status, diff)
+	}
+	if got, _, status := runFilesize(t, "", "-diff-baseline", baseline, dir); status != 0 || got != diff {
+		t.Errorf("-diff-baseline: exit status %d, output\n%s\nwant the -diff output\n%s", status, got, diff)
+	}
+	if _, stderr, status := runFilesize(t, "", "-diff-baseline", baseline, "-diff", "other.json", dir); status != 1 ||
+		!strings.Contains(stderr, "cannot be used with -diff") {
+		t.Errorf("both with different files: exit status %d, stderr:\n%s", status, stderr)
+	}
+}
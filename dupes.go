@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DupeGroup is a set of files with identical contents
+type DupeGroup struct {
+	Hash  string      // SHA-256 of the contents, hex encoded
+	Size  int64       // Size of each copy
+	Files []*FileInfo // Copies sorted by path
+}
+
+// Reclaimable returns the bytes freed by keeping only one copy
+func (g DupeGroup) Reclaimable() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// findDuplicates groups the files of all trees that are at least minSize
+// bytes by content. Only files sharing a size with another file are read,
+// on a bounded set of workers. It also returns how many files couldn't be
+// hashed.
+func findDuplicates(roots []*FileInfo, minSize int64) ([]DupeGroup, int) {
+	var files []*FileInfo
+	for _, root := range roots {
+		files = collectFiles(root, files)
+	}
+
+	bySize := make(map[int64][]*FileInfo)
+	for _, file := range files {
+		// Symlinks are sized by their target path, and other hard links
+		// to a counted file share its storage, so neither frees anything
+		if file.IsSymlink || file.HardLink || file.Size < max(minSize, 1) {
+			continue
+		}
+		bySize[file.Size] = append(bySize[file.Size], file)
+	}
+
+	var candidates []*FileInfo
+	for _, same := range bySize {
+		if len(same) > 1 {
+			candidates = append(candidates, same...)
+		}
+	}
+
+	sums := make([]string, len(candidates))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for i := 0; i < min(runtime.NumCPU(), len(candidates)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				sum, err := hashFile(candidates[j].Path, sha256.New())
+				if err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+					continue
+				}
+				sums[j] = sum
+			}
+		}()
+	}
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	type key struct {
+		size int64
+		sum  string
+	}
+	byContent := make(map[key][]*FileInfo)
+	for i, file := range candidates {
+		if sums[i] == "" {
+			continue
+		}
+		k := key{file.Size, sums[i]}
+		byContent[k] = append(byContent[k], file)
+	}
+
+	var groups []DupeGroup
+	for k, same := range byContent {
+		if len(same) < 2 {
+			continue
+		}
+		slices.SortFunc(same, func(a, b *FileInfo) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+		groups = append(groups, DupeGroup{Hash: k.sum, Size: k.size, Files: same})
+	}
+
+	// Most wasted space first
+	slices.SortFunc(groups, func(a, b DupeGroup) int {
+		if c := cmp.Compare(b.Reclaimable(), a.Reclaimable()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Files[0].Path, b.Files[0].Path)
+	})
+	return groups, failed
+}
+
+// printDuplicates prints each group of identical files with the space
+// its extra copies take, followed by a total
+func printDuplicates(w io.Writer, groups []DupeGroup, f SizeFormat) {
+	var total int64
+	copies := 0
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s of %s each, %s reclaimable (sha256 %s)\n",
+			pluralizeCount(len(group.Files), "copy", "copies"), formatSize(group.Size, f),
+			formatSize(group.Reclaimable(), f), group.Hash[:16])
+		for _, file := range group.Files {
+			fmt.Fprintf(w, "  %s\n", file.OutPath)
+		}
+		total += group.Reclaimable()
+		copies += len(group.Files) - 1
+	}
+
+	if len(groups) > 0 {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s, %s: %s duplicated\n",
+		pluralizeCount(len(groups), "group of identical files", "groups of identical files"),
+		pluralizeCount(copies, "extra copy", "extra copies"), formatSize(total, f))
+}
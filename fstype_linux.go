@@ -0,0 +1,61 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// fsTypeSupported reports whether filesystem type detection works on this platform
+const fsTypeSupported = true
+
+// fsTypeMagic maps filesystem type names to the f_type magic numbers
+// reported by statfs(2), as defined in linux/magic.h.
+// Note that devtmpfs reports the same magic as tmpfs, so the two
+// cannot be told apart.
+var fsTypeMagic = map[string]uint32{
+	"autofs":      0x0187,
+	"binfmt_misc": 0x42494e4d,
+	"bpf":         0xcafe4a11,
+	"btrfs":       0x9123683e,
+	"cgroup":      0x0027e0eb,
+	"cgroup2":     0x63677270,
+	"cifs":        0xff534d42,
+	"configfs":    0x62656570,
+	"debugfs":     0x64626720,
+	"devpts":      0x1cd1,
+	"devtmpfs":    0x01021994,
+	"efivarfs":    0xde5e81e4,
+	"ext2":        0xef53,
+	"ext3":        0xef53,
+	"ext4":        0xef53,
+	"fuse":        0x65735546,
+	"fusectl":     0x65735543,
+	"hugetlbfs":   0x958458f6,
+	"iso9660":     0x9660,
+	"mqueue":      0x19800202,
+	"nfs":         0x6969,
+	"nsfs":        0x6e736673,
+	"ntfs":        0x5346544e,
+	"overlay":     0x794c7630,
+	"proc":        0x9fa0,
+	"pstore":      0x6165676c,
+	"ramfs":       0x858458f6,
+	"securityfs":  0x73636673,
+	"selinuxfs":   0xf97cff8c,
+	"smb":         0x517b,
+	"squashfs":    0x73717368,
+	"sysfs":       0x62656572,
+	"tmpfs":       0x01021994,
+	"tracefs":     0x74726163,
+	"vfat":        0x4d44,
+	"xfs":         0x58465342,
+	"zfs":         0x2fc12fc1,
+}
+
+// fsTypeOf returns the statfs magic number of the filesystem holding path
+func fsTypeOf(path string) (uint32, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint32(st.Type), nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+// fsTypeSupported reports whether filesystem type detection works on this platform
+const fsTypeSupported = false
+
+// fsTypeMagic is empty since statfs magic numbers are Linux-specific
+var fsTypeMagic = map[string]uint32{}
+
+// fsTypeOf is a no-op on platforms without statfs magic numbers
+func fsTypeOf(path string) (uint32, error) {
+	return 0, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern line of a .gitignore file
+type ignoreRule struct {
+	segments []string // Pattern split on "/", "**" matches any number of segments
+	negate   bool     // Pattern started with "!" and re-includes matches
+	dirOnly  bool     // Pattern ended with "/" and only matches directories
+	anchored bool     // Pattern contains a "/" and matches relative to its directory
+}
+
+// gitignore holds the rules of the .gitignore files from the scan root
+// down to the directory being walked. Each directory gets its own link,
+// so the chain is never modified once built.
+type gitignore struct {
+	dir    string
+	rules  []ignoreRule
+	parent *gitignore
+}
+
+// loadGitignore returns the rules in effect inside dir: those of its
+// .gitignore file, if any, layered over parent's
+func loadGitignore(dir string, parent *gitignore) *gitignore {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return parent
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return parent
+	}
+	return &gitignore{dir: dir, rules: rules, parent: parent}
+}
+
+// parseIgnoreRule parses one .gitignore line, reporting false for blank
+// lines and comments
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:] // Escaped leading "#" or "!"
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, false
+	}
+
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// ignored reports whether the entry at fullPath is excluded. Later rules
+// override earlier ones and deeper .gitignore files override shallower
+// ones, so the first match searching backwards decides.
+func (g *gitignore) ignored(fullPath string, isDir bool) bool {
+	for ; g != nil; g = g.parent {
+		rel, err := filepath.Rel(g.dir, fullPath)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			continue // Rules only apply inside their own directory
+		}
+		for i := len(g.rules) - 1; i >= 0; i-- {
+			if g.rules[i].matches(rel, isDir) {
+				return !g.rules[i].negate
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether rel, a slash-separated path relative to the
+// .gitignore's directory, matches the rule
+func (r *ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		// A pattern without a slash matches the name at any depth
+		matched, _ := path.Match(r.segments[0], path.Base(rel))
+		return matched
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" segment matches zero or more path segments
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// A trailing "**" matches everything inside, not the directory itself
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
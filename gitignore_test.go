@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// filePaths returns the slash-separated paths of the files below root,
+// relative to it, sorted
+func filePaths(t *testing.T, root *FileInfo) []string {
+	t.Helper()
+	var paths []string
+	for _, file := range collectFiles(root, nil) {
+		paths = append(paths, relativePath(root.Path, file.Path))
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestGitignoreScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore": "# build output\n*.log\n!keep.log\nbuild/\n/top.txt\ndocs/*.tmp\n",
+		"a.log":      "x",
+		"keep.log":   "x",
+		"c.dat":      "x",
+		"top.txt":    "x",
+		"build/out":  "x",
+		"docs/x.tmp": "x",
+		// Anchored patterns only match relative to their .gitignore
+		"docs/deep/y.tmp": "x",
+		// A nested .gitignore applies below its directory and overrides the outer one
+		"sub/.gitignore": "!b.log\n*.dat\n",
+		"sub/b.log":      "x",
+		"sub/c.log":      "x",
+		"sub/c.dat":      "x",
+		"sub/top.txt":    "x",
+		"sub/keep.log":   "x",
+		"sub/build":      "x", // A file, so build/ doesn't match it
+	})
+
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, GitIgnore: true})
+	want := []string{
+		".gitignore",
+		"c.dat",
+		"docs/deep/y.tmp",
+		"keep.log",
+		"sub/.gitignore",
+		"sub/b.log",
+		"sub/build",
+		"sub/keep.log",
+		"sub/top.txt",
+	}
+	if got := filePaths(t, root); !slices.Equal(got, want) {
+		t.Errorf("got files\n%v\nwant\n%v", got, want)
+	}
+	if slices.Contains(childNames(root), "build") {
+		t.Errorf("the ignored build/ directory should be left out")
+	}
+	if root.Count != len(want) {
+		t.Errorf("totals count %d files, want %d", root.Count, len(want))
+	}
+}
+
+func TestGitignoreRules(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":   "*.o\n!important.o\ntmp/\n/root-only\nlib/**/gen\n\\#literal\n",
+		"a/.gitignore": "!*.o\n",
+	})
+	top := loadGitignore(dir, nil)
+	nested := loadGitignore(filepath.Join(dir, "a"), top)
+
+	tests := []struct {
+		name    string
+		g       *gitignore
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"unanchored at top", top, "x.o", false, true},
+		{"unanchored deep", top, "b/c/x.o", false, true},
+		{"negation", top, "b/important.o", false, false},
+		{"dir-only matches dir", top, "b/tmp", true, true},
+		{"dir-only skips file", top, "b/tmp", false, false},
+		{"anchored at its directory", top, "root-only", false, true},
+		{"anchored not deeper", top, "b/root-only", false, false},
+		{"double star, no segments", top, "lib/gen", true, true},
+		{"double star, several segments", top, "lib/x/y/gen", false, true},
+		{"double star elsewhere", top, "src/lib/gen", false, false},
+		{"escaped hash", top, "#literal", false, true},
+		{"no match", top, "main.go", false, false},
+		{"nested file re-includes", nested, "a/x.o", false, false},
+		{"nested file only applies below it", nested, "b/x.o", false, true},
+		{"outer rules still apply", nested, "a/tmp", true, true},
+	}
+	for _, tt := range tests {
+		if got := tt.g.ignored(filepath.Join(dir, filepath.FromSlash(tt.path)), tt.isDir); got != tt.ignored {
+			t.Errorf("%s: ignored(%s) = %t, want %t", tt.name, tt.path, got, tt.ignored)
+		}
+	}
+}
+
+func TestGitignoreMissing(t *testing.T) {
+	if g := loadGitignore(t.TempDir(), nil); g != nil {
+		t.Errorf("a directory without .gitignore should add no rules")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("# only a comment\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if g := loadGitignore(dir, nil); g != nil {
+		t.Errorf("a .gitignore without patterns should add no rules")
+	}
+}
@@ -1,3 +1,20 @@
 module github.com/XiaofengCode/filesize
 
 go 1.23.2
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/mattn/go-runewidth v0.0.16
+	github.com/zeebo/blake3 v0.2.4
+	golang.org/x/sys v0.29.0
+)
+
+require (
+	github.com/gdamore/encoding v1.0.1 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/rivo/uniseg v0.4.3 // indirect
+	golang.org/x/term v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
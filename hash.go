@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zeebo/blake3"
+)
+
+// hashAlgorithms maps -hash names to their constructors
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"blake3": func() hash.Hash { return blake3.New() },
+}
+
+// hashAlgorithmNames returns the supported -hash values in sorted order
+func hashAlgorithmNames() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hashPool hashes file contents on a bounded set of workers while the
+// walk continues, storing the hex digest in each node's Hash field
+type hashPool struct {
+	newHash func() hash.Hash
+	jobs    chan *FileInfo
+	wg      sync.WaitGroup
+	failed  atomic.Int64
+}
+
+func newHashPool(newHash func() hash.Hash) *hashPool {
+	p := &hashPool{
+		newHash: newHash,
+		jobs:    make(chan *FileInfo, 64),
+	}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p
+}
+
+func (p *hashPool) worker() {
+	defer p.wg.Done()
+	for node := range p.jobs {
+		sum, err := hashFile(node.Path, p.newHash())
+		if err != nil {
+			p.failed.Add(1)
+			continue
+		}
+		node.Hash = sum
+	}
+}
+
+// add queues node for hashing. It is safe to call on a nil pool.
+func (p *hashPool) add(node *FileInfo) {
+	if p == nil {
+		return
+	}
+	p.jobs <- node
+}
+
+// wait blocks until every queued file is hashed and returns how many
+// couldn't be read. It is safe to call on a nil pool.
+func (p *hashPool) wait() int {
+	if p == nil {
+		return 0
+	}
+	close(p.jobs)
+	p.wg.Wait()
+	return int(p.failed.Load())
+}
+
+// hashFile returns the hex digest of the file's contents
+func hashFile(path string, h hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// printHashManifest prints a HASH<TAB>SIZE<TAB>PATH line for every hashed
+// file in tree order, with paths relative to rootPath
+func printHashManifest(w io.Writer, node *FileInfo, rootPath string) {
+	if !node.IsDir && node.Hash != "" {
+		path := strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(relativePath(rootPath, node.Path))
+		fmt.Fprintf(w, "%s\t%d\t%s\n", node.Hash, node.Size, path)
+	}
+
+	for _, child := range node.Children {
+		printHashManifest(w, child, rootPath)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// defaultBuckets are the upper bounds of the -histogram size ranges
+// unless -buckets is given
+var defaultBuckets = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+
+// histogramBarWidth is the width of the -histogram bars in characters
+const histogramBarWidth = 30
+
+// SizeBucket counts the files whose size falls in [Min, Max)
+type SizeBucket struct {
+	Min, Max  int64 // Max is -1 for the last, unbounded bucket
+	FileCount int
+	Size      int64
+}
+
+// parseBuckets parses the -buckets list of sizes, which must increase
+func parseBuckets(list []string) ([]int64, error) {
+	bounds := make([]int64, 0, len(list))
+	for _, item := range list {
+		bound, err := parseSize(item)
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("bucket boundaries must increase, but %s follows %s", item, list[len(bounds)-1])
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// sizeHistogram counts the files of all trees in the ranges between
+// bounds: below the first, between each pair and from the last up.
+// Hard links counted elsewhere are left out.
+func sizeHistogram(roots []*FileInfo, bounds []int64) []SizeBucket {
+	buckets := make([]SizeBucket, len(bounds)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].Min = bounds[i-1]
+		}
+		buckets[i].Max = -1
+		if i < len(bounds) {
+			buckets[i].Max = bounds[i]
+		}
+	}
+
+	var files []*FileInfo
+	for _, root := range roots {
+		files = collectFiles(root, files)
+	}
+	for _, file := range files {
+		if file.HardLink {
+			continue
+		}
+		i := 0
+		for i < len(bounds) && file.Size >= bounds[i] {
+			i++
+		}
+		buckets[i].FileCount++
+		buckets[i].Size += file.Size
+	}
+	return buckets
+}
+
+// printHistogram prints the file count and total size per size range
+// with their shares of all files, and a bar of # for the share of files
+func printHistogram(w io.Writer, roots []*FileInfo, bounds []int64, f SizeFormat) {
+	buckets := sizeHistogram(roots, bounds)
+
+	labels := make([]string, len(buckets))
+	width := len("Size")
+	for i, b := range buckets {
+		switch {
+		case i == 0:
+			labels[i] = "< " + formatSize(b.Max, f)
+		case b.Max < 0:
+			labels[i] = ">= " + formatSize(b.Min, f)
+		default:
+			labels[i] = formatSize(b.Min, f) + " - " + formatSize(b.Max, f)
+		}
+		width = max(width, len(labels[i]))
+	}
+
+	var totalFiles int
+	var totalSize int64
+	for _, b := range buckets {
+		totalFiles += b.FileCount
+		totalSize += b.Size
+	}
+	share := func(part, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(part) / float64(total) * 100
+	}
+
+	fmt.Fprintf(w, "%-*s %8s %7s %12s %7s\n", width, "Size", "Files", "Files%", "Total", "Size%")
+	for i, b := range buckets {
+		filesShare := share(int64(b.FileCount), int64(totalFiles))
+		bar := strings.Repeat("#", int(math.Round(filesShare/100*histogramBarWidth)))
+		line := fmt.Sprintf("%-*s %8d %6.1f%% %12s %6.1f%%  %s", width, labels[i],
+			b.FileCount, filesShare, formatSize(b.Size, f), share(b.Size, totalSize), bar)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// hardLinkID reports no hard links where inode numbers aren't available,
+// so every link is counted
+func hardLinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// deviceID reports no device, so -same-device never stops the walk
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
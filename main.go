@@ -1,31 +1,324 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-runewidth"
 )
 
 type FileInfo struct {
-	Name     string
-	Size     int64
-	IsDir    bool
-	Path     string
-	Children []*FileInfo
+	Name        string
+	Size        int64
+	DiskSize    int64 // Bytes allocated on disk, in blocks
+	ModTime     time.Time
+	Count       int // Files contained recursively
+	DirCount    int // Subdirectories contained recursively
+	IsDir       bool
+	Path        string
+	OutPath     string // Path as printed: Path, or relative to the scan root with -relative
+	Children    []*FileInfo
+	Skipped     int       // Entries in this directory that couldn't be read
+	IsSymlink   bool      // The entry itself is a symbolic link
+	LinkTarget  string    // Where the symlink points, if IsSymlink
+	Hash        string    // Hex digest of the contents when -hash is set
+	Summarized  bool      // Fully sized, but displayed as a single line without children
+	HardLink    bool      // Another link to a file already counted elsewhere, sized 0
+	Omitted     int       // Entries this synthetic "... and N more" line stands for
+	Newest      time.Time // Latest ModTime in a directory's subtree, or the ModTime of a file
+	Device      uint64    // Device of a directory's filesystem, 0 where unknown
+	IsMount     bool      // A directory on another filesystem than its parent
+	IsArchive   bool      // An archive file whose Children are its entries, with -into-archives
+	ArchiveSize int64     // Uncompressed size of an archive's entries
+	InArchive   bool      // An entry inside an archive rather than on disk
 }
 
 // JSONFileInfo represents file info for JSON serialization
 type JSONFileInfo struct {
-	Name      string          `json:"name"`
-	Size      int64           `json:"size"`
-	SizeStr   string          `json:"sizeStr"`
-	IsDir     bool            `json:"isDir"`
-	Path      string          `json:"path"`
-	Children  []*JSONFileInfo `json:"children"`
+	Name            string          `json:"name"`
+	Size            int64           `json:"size"`
+	DiskSize        int64           `json:"diskSize"`
+	ModTime         string          `json:"modTime"` // RFC 3339 in UTC with fixed-width nanoseconds, so it sorts as text
+	FileCount       int             `json:"fileCount"`
+	DirCount        int             `json:"dirCount"`
+	SizeStr         string          `json:"sizeStr"`
+	SizeBytes       int64           `json:"sizeBytes"` // Same as size
+	SizeValue       float64         `json:"sizeValue"` // The number in sizeStr
+	SizeUnit        string          `json:"sizeUnit"`  // The unit in sizeStr
+	IsDir           bool            `json:"isDir"`
+	Path            string          `json:"path"`
+	Children        []*JSONFileInfo `json:"children"`
+	Skipped         int             `json:"skipped,omitempty"`
+	IsSymlink       bool            `json:"isSymlink,omitempty"`
+	LinkTarget      string          `json:"linkTarget,omitempty"`
+	Hash            string          `json:"hash,omitempty"`
+	Summarized      bool            `json:"summarized,omitempty"`
+	PercentOfParent float64         `json:"percentOfParent"`
+	HardLink        bool            `json:"hardLink,omitempty"`
+	IsMount         bool            `json:"isMount,omitempty"`
+	IsArchive       bool            `json:"isArchive,omitempty"`
+	ArchiveSize     int64           `json:"archiveSize,omitempty"` // Uncompressed, while size is the archive's own
+	InArchive       bool            `json:"inArchive,omitempty"`
+	AgeSeconds      int64           `json:"ageSeconds"` // Since the newest change, as shown by -age
+	Omitted         int             `json:"omitted,omitempty"`
+	ByExtension     []ExtensionStat `json:"byExtension,omitempty"` // Only on roots, with -by-ext
+}
+
+// jsonVersion is the version of the JSONDocument layout. It is raised
+// when a field is renamed or removed, not when one is added.
+const jsonVersion = 1
+
+// JSONDocument wraps the trees of the -json, -html and -save output
+// with the information a parser needs to rely on their shape
+type JSONDocument struct {
+	Version     int             `json:"version"`
+	GeneratedAt string          `json:"generatedAt"` // RFC 3339
+	Args        []string        `json:"args"`        // Command line arguments, without the program name
+	Root        *JSONFileInfo   `json:"root,omitempty"`
+	Roots       []*JSONFileInfo `json:"roots,omitempty"` // Instead of root when several directories were scanned
+}
+
+// NDJSONEntry is one line of the -ndjson output
+type NDJSONEntry struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	SizeStr string `json:"sizeStr"`
+	IsDir   bool   `json:"isDir"`
+	Depth   int    `json:"depth"` // 0 for the scan root
+}
+
+// ExtensionStat is the combined size of the files sharing an extension
+type ExtensionStat struct {
+	Extension string  `json:"extension"` // Lowercase with leading dot, or (none)
+	Size      int64   `json:"size"`
+	SizeStr   string  `json:"sizeStr"`
+	FileCount int     `json:"fileCount"`
+	Percent   float64 `json:"percent"` // Share of the size of all files
+}
+
+// ScanOptions controls how the file tree is built
+type ScanOptions struct {
+	SkipFSTypes  map[uint32]bool  // statfs magic numbers of filesystems not to descend into
+	MaxDepth     int              // Deepest level of directories -stream prints, -1 for unlimited; the tree always holds everything
+	Retries      int              // Times to retry transient filesystem errors
+	Progress     io.Writer        // Destination for JSON progress events, nil to disable
+	Hash         func() hash.Hash // Hash file contents during the walk, nil to disable
+	Summarize    []string         // Name patterns of directories to display as a single line
+	Exclude      []string         // Name patterns of entries to skip entirely
+	Include      []string         // Name patterns of the only files to count, nil for all
+	Regexp       *regexp.Regexp   // Matches the names of the only files to count, nil for all
+	RegexpPath   bool             // Match Regexp against the printed path instead of the name
+	Follow       bool             // Follow symlinks instead of counting the links themselves
+	Jobs         int              // Directories read concurrently, 1 for a sequential walk
+	SkipHidden   bool             // Skip dotfiles and dot-directories below the root
+	IntoArchives bool             // List the entries of zip and tar files as their children
+	GitIgnore    bool             // Skip entries matched by .gitignore files in the scanned directories
+	Extensions   map[string]bool  // Lowercase extensions with leading dot of the only files to count, nil for all
+	CountLinks   bool             // Count every hard link to a file instead of only the first
+	DiskUsage    bool             // Use the allocated size as each file's size
+	SameDevice   bool             // Don't descend into directories on other devices than the root
+	Relative     bool             // Print paths relative to the scan root, with forward slashes
+	ResolveRoot  bool             // Resolve symlinks in the root path instead of showing the link
+	OlderThan    time.Duration    // Only count files last modified more than this long ago, 0 for all
+	NewerThan    time.Duration    // Only count files last modified less than this long ago, 0 for all
+}
+
+// optionalFile is a flag that can be given alone (-json) to write to
+// stdout, or with a value (-json=out.json) to write to a file
+type optionalFile struct {
+	set  bool
+	path string
+}
+
+func (f *optionalFile) String() string {
+	return f.path
+}
+
+func (f *optionalFile) Set(value string) error {
+	switch value {
+	case "true":
+		f.set, f.path = true, ""
+	case "false":
+		f.set, f.path = false, ""
+	default:
+		f.set, f.path = true, value
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value
+func (f *optionalFile) IsBoolFlag() bool {
+	return true
+}
+
+// stringList is a repeatable flag whose values may also be comma-separated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// ScanStats collects counters gathered while building the tree
+type ScanStats struct {
+	Recovered  int            // Paths read successfully after retrying
+	HashFailed int            // Files whose contents couldn't be hashed
+	Skipped    []SkippedEntry // Entries left out because of errors, sorted by path
+	Stopped    error          // Why the scan ended early, from its context, nil if it finished
+}
+
+// SkippedEntry is a path that couldn't be read and why
+type SkippedEntry struct {
+	Path string
+	Err  error
+}
+
+// exitPartial is the exit status when the output was written but some
+// entries couldn't be read, so scripts can tell it from a clean run (0)
+// and a fatal error (1)
+const exitPartial = 2
+
+// exitStopped is the exit status when the scan was cut short by -timeout
+// or Ctrl-C and the output shows only what was scanned until then
+const exitStopped = 3
+
+// errSymlinkLoop is returned for a followed symlink that leads back to
+// one of its own ancestors
+var errSymlinkLoop = errors.New("symlink loop")
+
+// scanner holds the options and running state of one tree build
+type scanner struct {
+	opts     *ScanOptions
+	mu       sync.Mutex // Guards stats and links
+	stats    ScanStats
+	links    map[fileID][]hardLink // Files with several hard links, by inode
+	progress *progressReporter
+	hashes   *hashPool
+	slots    chan struct{} // Extra walker goroutines allowed besides the caller's
+	rootDev  uint64        // Device of the scan root, for SameDevice
+
+	modifiedBefore time.Time // Cutoff for OlderThan, zero if unset
+	modifiedAfter  time.Time // Cutoff for NewerThan, zero if unset
+}
+
+// ancestor is one directory on the path from the scan root, used to
+// detect symlink loops and to correct totals for hard links. Each
+// goroutine walks its own chain, so the chain is never modified once
+// built.
+type ancestor struct {
+	node     *FileInfo
+	realPath string // Resolved path, only when following symlinks
+	parent   *ancestor
+}
+
+// fileID identifies a file independently of the links pointing to it
+type fileID struct {
+	dev, ino uint64
+}
+
+// hardLink is one occurrence of a file with several hard links
+type hardLink struct {
+	node    *FileInfo
+	parents *ancestor
+}
+
+func (a *ancestor) contains(realPath string) bool {
+	for ; a != nil; a = a.parent {
+		if a.realPath != "" && a.realPath == realPath {
+			return true
+		}
+	}
+	return false
+}
+
+// HTMLOptions controls the generated HTML page
+type HTMLOptions struct {
+	Format        SizeFormat
+	SortType      SortType // Initial sort selection, matching the terminal order
+	Reverse       bool
+	CollapseOver  int         // Folders with more children than this start collapsed, 0 to disable
+	CollapseBelow int64       // Folders smaller than this many bytes start collapsed, 0 to disable
+	Theme         string      // Default color theme: light, dark or auto
+	JSON          JSONOptions // Layout of the embedded trees
+}
+
+// UnitSystem selects the base and labels formatSize uses
+type UnitSystem int
+
+const (
+	UnitsBinary UnitSystem = iota // 1024-based, labeled KB, MB, ...
+	UnitsSI                       // 1000-based, labeled kB, MB, ...
+	UnitsIEC                      // 1024-based, labeled KiB, MiB, ...
+)
+
+// unitLabels lists the labels for bytes, kilo, mega, giga and tera in each system
+var unitLabels = map[UnitSystem][]string{
+	UnitsBinary: {"B", "KB", "MB", "GB", "TB"},
+	UnitsSI:     {"B", "kB", "MB", "GB", "TB"},
+	UnitsIEC:    {"B", "KiB", "MiB", "GiB", "TiB"},
+}
+
+// SizeFormat controls how formatSize renders byte counts
+type SizeFormat struct {
+	System    UnitSystem
+	Unit      string // Fixed unit (B, KB, MB, GB or TB), empty to scale automatically
+	Precision int    // Decimal places shown for units larger than bytes
+}
+
+// TreeOptions controls how printFileTree renders each line
+type TreeOptions struct {
+	Format        SizeFormat
+	ShowBothSizes bool      // Show apparent and on-disk size side by side
+	ShowTime      bool      // Show each entry's modification time
+	ShowAge       bool      // Show the time since each entry's newest change, colored with Color
+	ShowPercent   bool      // Show each entry's share of its parent's size
+	BarWidth      int       // Width of the size bar in front of each line, 0 for none
+	Style         treeStyle // Connectors and bar characters, see treeStyleFor
+	Align         bool      // Line the sizes up in a right-justified column after the tree
+	Collapse      bool      // Show chains of directories with a single subdirectory as one line
+	ShowMounts    bool      // Mark mount points with [mount] and the size of their filesystem
+	SummaryDepth  int       // Show the contents of directories at this depth as one summary line, -1 to list everything
+	Color         bool      // Highlight names and sizes with ANSI escape codes
+	LargeSize     int64     // Files of at least this size are highlighted when Color is set
+	MaxLines      int       // Stop printing after this many lines, 0 for no limit
+
+	depth     int        // Depth of the entry being printed, 0 for the root
+	rootSize  int64      // Size the bars are relative to
+	now       time.Time  // Time ages are measured from
+	lines     []treeLine // Lines held back until the column widths are known, with Align
+	printed   int        // Lines printed so far
+	truncated int        // Lines left out because of MaxLines
 }
 
 type SortType int
@@ -33,281 +326,2908 @@ type SortType int
 const (
 	SortByName SortType = iota
 	SortBySize
+	SortByMtime
+	SortByNatural
+	SortByCount
+	SortByExt
 )
 
+// String returns the -sort flag value for the sort type
+func (t SortType) String() string {
+	switch t {
+	case SortBySize:
+		return "size"
+	case SortByMtime:
+		return "mtime"
+	case SortByNatural:
+		return "natural"
+	case SortByCount:
+		return "count"
+	case SortByExt:
+		return "ext"
+	default:
+		return "name"
+	}
+}
+
 func main() {
 	var (
-		sortBy     = flag.String("sort", "name", "Sort method: name (by name) or size (by size)")
-		reverse    = flag.Bool("reverse", false, "Reverse sort order")
-		htmlOutput = flag.String("html", "", "Output to HTML file (e.g., output.html)")
+		sortBy           = flag.String("sort", "name", "Sort method: name (by name), natural (by name, numbers by value), size (by size), mtime (newest first), count (most files first) or ext (files by extension)")
+		reverse          = flag.Bool("reverse", false, "Reverse sort order")
+		showTime         = flag.Bool("show-time", false, "Show the modification time of each entry (RFC 3339)")
+		showAge          = flag.Bool("age", false, "Show how long ago each entry changed, e.g. 12d or 3mo; for directories, their newest content. Colored from green to red with -color")
+		percent          = flag.Bool("percent", false, "Show each entry's share of its parent directory's size")
+		bars             = flag.Bool("bars", false, "Draw a bar showing each entry's share of the total size")
+		barWidth         = flag.Int("bar-width", 20, "Width of the -bars bar in characters")
+		colorMode        = flag.String("color", "auto", "Colorize the tree: auto (only when stdout is a terminal), always or never")
+		largeThreshold   = flag.String("large-threshold", "100MB", "Highlight files of at least SIZE in red when the tree is colored")
+		resolveRoot      = flag.Bool("resolve-root", false, "If a target is a symlink, show it under its real name and path instead of the link's")
+		follow           = flag.Bool("follow", false, "Follow symlinks to files and directories instead of counting the links themselves")
+		top              = flag.Int("top", 0, "List only the N largest files across the whole tree, with full paths")
+		empty            = flag.Bool("empty", false, "Instead of the tree, list directories that contain no files, for cleanup")
+		histogram        = flag.Bool("histogram", false, "Instead of the tree, print the number and total size of files per size range as a bar chart")
+		dupes            = flag.Bool("dupes", false, "Instead of the tree, list groups of files with identical contents and the space their extra copies take")
+		minDupeSize      = flag.String("min-dupe-size", "1", "Ignore files smaller than SIZE (e.g. 4KB) when looking for -dupes")
+		byExt            = flag.Bool("by-ext", false, "Instead of the tree, print total size and file count per extension, largest first")
+		flat             = flag.Bool("flat", false, "Instead of the tree, print one line per directory with its total size and path, largest first, like du | sort -rh")
+		depth            = flag.Int("depth", -1, "Only show entries down to N levels below the target (-1 for unlimited); sizes still include everything")
+		minDepth         = flag.Int("min-depth", 0, "With -flat or -top, leave out entries fewer than N levels below the target")
+		summaryDepth     = flag.Int("max-depth-size", -1, "In the tree, replace the contents of directories N levels below the target with one line of their total size and counts (-1 to list everything)")
+		noRecurse        = flag.Bool("no-recurse", false, "List only the target's immediate children, like ls, with full directory sizes; same as -depth 1")
+		olderThan        = flag.String("older-than", "", "Only count files last modified more than AGE ago (e.g. 30d, 2w, 12h)")
+		newerThan        = flag.String("newer-than", "", "Only count files last modified less than AGE ago (e.g. 7d, 1w, 30m)")
+		ignoreOver       = flag.String("ignore-over", "", "Hide files larger than SIZE (e.g. 100MB) to focus on the long tail of small files")
+		ignoreOverTotals = flag.Bool("ignore-over-totals", false, "Also subtract files hidden by -ignore-over from directory totals")
+		nameRegexp       = flag.String("regex", "", "Only count files whose name matches a regular expression (e.g. '^IMG_\\d+\\.jpe?g$')")
+		regexpPath       = flag.Bool("regex-path", false, "Match -regex against each file's path instead of its name")
+		pruneEmpty       = flag.Bool("prune-empty", false, "Hide directories left without files by the filters (default: on when -ext, -min-size or another filter is used)")
+		entryType        = flag.String("type", "", "Show only files (f) or only directories (d); directory totals still include everything")
+		minSize          = flag.String("min-size", "", "Hide files and directories smaller than SIZE (e.g. 10MB) to focus on the largest entries")
+		maxLines         = flag.Int("max-lines", 0, "Stop printing the tree after N lines (0 for no limit)")
+		maxChildren      = flag.Int("max-children", 0, "Show at most N entries per directory, summarizing the rest in one line (0 for no limit)")
+		relative         = flag.Bool("relative", false, "Print paths relative to the scan root (shown as .) with forward slashes, instead of absolute paths")
+		outputFile       = flag.String("output", "", "Write the text output (tree, -top, -by-ext, -json, ...) to a file instead of stdout")
+		tui              = flag.Bool("tui", false, "Browse the tree in a full-screen terminal UI: arrow keys to move, Enter to open a directory, Backspace to go up, q to quit")
+		stream           = flag.Bool("stream", false, "Print each directory's total as soon as it is scanned, subdirectories first, without keeping the tree in memory; for huge filesystems. No sorting or tree view")
+		watch            = flag.Bool("watch", false, "After the first scan, scan again and redraw whenever files change, until interrupted")
+		fromStdin        = flag.Bool("from-stdin", false, "Also read paths to scan from stdin, one per line (e.g. find . -type d | filesize -from-stdin)")
+		verbose          = flag.Bool("verbose", false, "List every path that couldn't be read and why, not just a count")
+		precision        = flag.Int("precision", 2, "Decimal places of sizes in KB and larger units, 0 to 3 (bytes are always whole)")
+		unit             = flag.String("unit", "", "Show all sizes in a fixed unit: B, KB, MB, GB or TB (default: automatic)")
+		si               = flag.Bool("si", false, "Use decimal units (1 kB = 1000 B) labeled kB, MB, GB")
+		iec              = flag.Bool("iec", false, "Use binary units (1 KiB = 1024 B) labeled KiB, MiB, GiB")
+		hashAlgo         = flag.String("hash", "", "Hash file contents during the scan: md5, sha1, sha256, crc32 or blake3")
+		hashOutput       = flag.Bool("hash-output", false, "Print a HASH<TAB>SIZE<TAB>PATH manifest line per file instead of the tree (requires -hash)")
+		quiet            = flag.Bool("quiet", false, "Print only the total size of the target directories, instead of the tree")
+		rawBytes         = flag.Bool("bytes", false, "With -quiet, print the total as a plain number of bytes")
+		showStats        = flag.Bool("stats", false, "Print the scan time and the files and bytes counted per second to stderr")
+		ascii            = flag.Bool("ascii", false, "Draw the tree connectors and bars with ASCII characters (|--, `--, #) instead of box drawing")
+		collapse         = flag.Bool("collapse", false, "Show chains of directories that only contain one subdirectory as a single line, e.g. a/b/c/")
+		align            = flag.Bool("align", false, "Right-justify the sizes of the text tree in a column after the names")
+		noTree           = flag.Bool("no-tree", false, "Indent the tree with two spaces per level instead of box-drawing connectors, for grep and diff")
+		machineTree      = flag.Bool("machine-tree", false, "Print the tree as depth<TAB>name<TAB>bytes lines for scripts")
+		bothSizes        = flag.Bool("show-both-sizes", false, "Show apparent size and on-disk (allocated) size side by side")
+		apparent         = flag.Bool("apparent", true, "Count apparent sizes (bytes of content); -apparent=false counts the space allocated on disk like du, which is smaller for sparse files and larger for small files on big blocks")
+		mountSummary     = flag.Bool("follow-mount-summary", false, "Mark directories on another filesystem than their parent with [mount] and the filesystem's size")
+		sameDevice       = flag.Bool("same-device", false, "Don't descend into directories on other filesystems than the target, like du -x")
+		countLinks       = flag.Bool("count-symlinks", false, "Print a summary counting symlinks separately from files and dirs")
+		countHardLinks   = flag.Bool("count-links", false, "Count the size of every hard link to a file instead of only the first")
+		disk             = flag.Bool("disk", false, "After the output, print to stderr how much of its volume each target takes and how much space is free")
+		summary          = flag.Bool("summary", false, "After the output, print the total size, file count and directory count of each target to stderr")
+		outputFormat     = flag.String("format", "tree", "Output format: tree, json, ndjson, csv, tsv, html or md; written to stdout or -output FILE")
+		htmlOutput       = flag.String("html", "", "Output to HTML file (e.g., output.html); same as -format html -output FILE")
+		csvOutput        = flag.String("csv", "", "Write one CSV row per file and directory to a file (e.g., output.csv)")
+		bom              = flag.Bool("bom", false, "Start the -csv and -output files with a UTF-8 byte order mark, for Excel on Windows")
+		crlf             = flag.Bool("crlf", false, "End the rows of the -csv file and of -format csv with CRLF, for Windows tools")
+		collapseOver     = flag.Int("html-collapse-over", 0, "In HTML output, start folders with more than N children collapsed (0 to disable)")
+		collapseBelow    = flag.String("collapse-below", "", "In HTML output, start folders smaller than this size (e.g. 1MB) collapsed")
+		theme            = flag.String("theme", "auto", "Default color theme of the HTML output: light, dark or auto (follow the system setting)")
+		dumpData         = flag.String("dump-data", "", "Write the JSON data embedded in the HTML output to a file (e.g., data.json)")
+		legacyJSON       = flag.Bool("legacy-json", false, "Write the bare tree in -json, -html, -dump-data, -save and -treemap output instead of a versioned document")
+		compactJSON      = flag.Bool("json-compact", false, "Write the JSON of -json, -html, -dump-data, -save and -treemap output on one line instead of indented")
+		saveFile         = flag.String("save", "", "Save the full scan as JSON to a file (e.g., baseline.json) to compare against later with -diff")
+		compareDir       = flag.String("compare", "", "Instead of the tree, scan a second directory and show both merged, marking entries only in the first (-), only in the second (+) or of different size (~)")
+		diffFile         = flag.String("diff", "", "Instead of the tree, list the paths added, removed, grown and shrunk since a scan saved with -save")
+		diffBaseline     = flag.String("diff-baseline", "", "Same as -diff FILE")
+		treemapOutput    = flag.String("treemap", "", "Write the sizes as a zoomable treemap to an HTML file (e.g., treemap.html)")
+		sizeMap          = flag.String("size-map", "", "Write a flat JSON map of relative path to size in bytes to a file (e.g., sizes.json)")
+		sizeMapDirs      = flag.Bool("size-map-dirs", false, "Include directories in the -size-map output")
+		timeout          = flag.Duration("timeout", 0, "Stop scanning after this long (e.g. 30s) and print what was found so far (default: no limit)")
+		retries          = flag.Int("retry", 0, "Retry transient filesystem errors (timeouts, EINTR) up to N times with backoff")
+		progressJSON     = flag.Bool("progress-json", false, "Emit newline-delimited JSON progress events to stderr while scanning")
+		skipFSTypes      = flag.String("skip-fstypes", "", "Comma-separated filesystem types not to descend into, e.g. proc,sysfs,tmpfs (Linux only)")
+		jobs             = flag.Int("jobs", runtime.NumCPU(), "Number of directories to read in parallel")
+		excludeHidden    = flag.Bool("exclude-hidden", false, "Skip files and directories whose name starts with a dot")
+		intoArchives     = flag.Bool("into-archives", false, "List the files inside .zip, .tar, .tar.gz and .tgz archives below them, with uncompressed sizes")
+		noConfig         = flag.Bool("no-config", false, "Ignore the .filesizerc files in the home and target directories")
+		gitignoreRules   = flag.Bool("gitignore", false, "Skip files and directories ignored by .gitignore files found during the scan")
 	)
 
+	var jsonOutput, ndjsonOutput, mdOutput optionalFile
+	flag.Var(&jsonOutput, "json", "Same as -format json; use -json=FILE, with =, to also set -output FILE")
+	flag.Var(&ndjsonOutput, "ndjson", "Same as -format ndjson; use -ndjson=FILE, with =, to also set -output FILE")
+	flag.Var(&mdOutput, "md", "Same as -format md; use -md=FILE, with =, to also set -output FILE")
+
+	var summarize, exclude, include, extensions, buckets stringList
+	flag.Var(&exclude, "exclude", "Skip entries whose name matches a glob pattern (e.g. node_modules, *.tmp); repeatable or comma-separated")
+	flag.Var(&include, "include", "Only count files whose name matches a glob pattern (e.g. *.mp4); repeatable or comma-separated")
+	flag.Var(&buckets, "buckets", "Upper bounds of the -histogram size ranges (default 1KB,10KB,100KB,1MB,10MB); repeatable or comma-separated")
+	flag.Var(&extensions, "ext", "Only count files with these extensions (e.g. .jpg,.png); repeatable or comma-separated")
+	flag.Var(&summarize, "summarize", "Count a directory (e.g. .git) in totals but show it as one line; repeatable or comma-separated")
+
 	// Custom usage message
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] [directory]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [directory ...]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Arguments:\n")
-		fmt.Fprintf(os.Stderr, "  directory\t\tTarget directory path (default: current directory)\n\n")
+		fmt.Fprintf(os.Stderr, "  directory\t\tTarget directory paths (default: current directory)\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s\t\t\tShow current directory\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s /path/to/dir\t\tShow specified directory\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s dirA dirB\t\tShow several directories\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -sort size .\t\tSort by size\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -sort name -reverse .\tReverse sort by name\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -exclude .git,node_modules .\tSkip directories by name\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -top 20 .\t\tList the 20 largest files\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -dupes -min-dupe-size 1MB .\tFind duplicate files\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -depth 2 .\t\tShow two levels only\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -html output.html .\tOutput to HTML file\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "\nNote: Flags must come before the directory argument\n")
+		fmt.Fprintf(os.Stderr, "  %s -csv output.csv .\tExport rows for a spreadsheet\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -json . | jq .size\tPrint the tree as JSON\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -dump-data data.json .\tWrite tree data as JSON\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -size-map sizes.json .\tWrite per-file sizes as a flat JSON map\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -skip-fstypes proc,sysfs /\tScan root, skipping pseudo-filesystems\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nExit status:\n")
+		fmt.Fprintf(os.Stderr, "  0\tSuccess\n")
+		fmt.Fprintf(os.Stderr, "  1\tFatal error, such as an invalid flag or a target that doesn't exist\n")
+		fmt.Fprintf(os.Stderr, "  %d\tFinished, but some entries couldn't be read and were skipped\n", exitPartial)
+		fmt.Fprintf(os.Stderr, "  %d\tStopped early by -timeout or Ctrl-C; the output is incomplete\n", exitStopped)
+		fmt.Fprintf(os.Stderr, "\nNote: Flags must come before the directory arguments\n")
+	}
+
+	flag.Parse()
+
+	// The flags given on the command line, before a config file sets more
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	// Defaults from .filesizerc files apply before any flag is read
+	if !*noConfig {
+		target := "."
+		if flag.NArg() > 0 {
+			target = flag.Arg(0)
+		}
+		if err := applyConfig(configFiles(target)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// "-json out.json" scans out.json instead of writing to it, since the
+	// flag can't tell its value from the target
+	for _, shorthand := range []struct {
+		name string
+		flag *optionalFile
+		exts []string
+	}{
+		{"json", &jsonOutput, []string{".json"}},
+		{"ndjson", &ndjsonOutput, []string{".ndjson", ".jsonl"}},
+		{"md", &mdOutput, []string{".md"}},
+	} {
+		if !shorthand.flag.set || shorthand.flag.path != "" || flag.NArg() == 0 {
+			continue
+		}
+		arg := flag.Arg(0)
+		if !slices.Contains(shorthand.exts, strings.ToLower(filepath.Ext(arg))) {
+			continue
+		}
+		if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: to write to %s, use -%s=%s; without = it is the directory to scan\n", arg, shorthand.name, arg)
+			os.Exit(1)
+		}
+	}
+
+	// Get target directories
+	targetDirs := flag.Args()
+	var stdinSkipped []SkippedEntry // Paths from -from-stdin that don't exist
+	if *fromStdin {
+		var paths []string
+		paths, stdinSkipped = readPathList(os.Stdin)
+		targetDirs = append(targetDirs, paths...)
+		if len(targetDirs) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: No existing paths given on stdin\n")
+			os.Exit(1)
+		}
+	} else if len(targetDirs) == 0 {
+		targetDirs = []string{"."}
+	}
+	if *compareDir != "" {
+		// The second tree is scanned like another target
+		if len(targetDirs) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: -compare takes exactly one other directory to compare with\n")
+			os.Exit(1)
+		}
+		targetDirs = append(targetDirs, *compareDir)
+	}
+
+	// Check if directories exist
+	for _, targetDir := range targetDirs {
+		if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: Directory '%s' does not exist\n", targetDir)
+			os.Exit(1)
+		}
+	}
+
+	// Parse sort type
+	var sortType SortType
+	switch strings.ToLower(*sortBy) {
+	case "size":
+		sortType = SortBySize
+	case "name":
+		sortType = SortByName
+	case "mtime":
+		sortType = SortByMtime
+	case "natural":
+		sortType = SortByNatural
+	case "count":
+		sortType = SortByCount
+	case "ext":
+		sortType = SortByExt
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid sort method '%s'. Use 'name', 'natural', 'size', 'mtime', 'count' or 'ext'\n", *sortBy)
+		os.Exit(1)
+	}
+
+	// Parse display units
+	if *precision < 0 || *precision > 3 {
+		fmt.Fprintf(os.Stderr, "Error: -precision must be between 0 and 3\n")
+		os.Exit(1)
+	}
+	sizeFormat := SizeFormat{Precision: *precision}
+	switch {
+	case *si && *iec:
+		fmt.Fprintf(os.Stderr, "Error: -si and -iec cannot be used together\n")
+		os.Exit(1)
+	case *si:
+		sizeFormat.System = UnitsSI
+	case *iec:
+		sizeFormat.System = UnitsIEC
+	}
+	if *unit != "" {
+		u, err := parseUnit(*unit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		sizeFormat.Unit = u
+	}
+
+	if *jobs < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -jobs must be at least 1\n")
+		os.Exit(1)
+	}
+
+	switch *colorMode {
+	case "auto", "always", "never":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid color mode '%s'. Use 'auto', 'always' or 'never'\n", *colorMode)
+		os.Exit(1)
+	}
+
+	switch *theme {
+	case "auto", "light", "dark":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid theme '%s'. Use 'auto', 'light' or 'dark'\n", *theme)
+		os.Exit(1)
+	}
+
+	if *noRecurse {
+		if *depth >= 0 && *depth != 1 {
+			fmt.Fprintf(os.Stderr, "Error: -no-recurse cannot be used with -depth %d\n", *depth)
+			os.Exit(1)
+		}
+		*depth = 1
+	}
+
+	if *maxChildren < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-children must not be negative\n")
+		os.Exit(1)
+	}
+
+	if *barWidth < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -bar-width must be at least 1\n")
+		os.Exit(1)
+	}
+
+	if *retries < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -retry must not be negative\n")
+		os.Exit(1)
+	}
+
+	// -html, -json and -md are shorthands for -format with -output
+	format := strings.ToLower(*outputFormat)
+	// The flags that chose the format and the output file, for the errors
+	formatFlag, outputFlag := "-format "+format, "-output "+*outputFile
+	selectFormat := func(name, path string) {
+		if format != "tree" && format != name {
+			fmt.Fprintf(os.Stderr, "Error: -%s cannot be used with %s\n", name, formatFlag)
+			os.Exit(1)
+		}
+		format, formatFlag = name, "-"+name
+		if path != "" {
+			if *outputFile != "" && *outputFile != path {
+				fmt.Fprintf(os.Stderr, "Error: -%s=%s cannot be used with %s\n", name, path, outputFlag)
+				os.Exit(1)
+			}
+			*outputFile, outputFlag = path, "-"+name+"="+path
+		}
+	}
+	switch format {
+	case "tree", "json", "ndjson", "csv", "tsv", "html", "md":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid format '%s'. Use 'tree', 'json', 'ndjson', 'csv', 'tsv', 'html' or 'md'\n", *outputFormat)
+		os.Exit(1)
+	}
+	if *htmlOutput != "" {
+		selectFormat("html", *htmlOutput)
+	}
+	if jsonOutput.set {
+		selectFormat("json", jsonOutput.path)
+	}
+	if ndjsonOutput.set {
+		selectFormat("ndjson", ndjsonOutput.path)
+	}
+	if mdOutput.set {
+		selectFormat("md", mdOutput.path)
+	}
+	if *diffBaseline != "" {
+		if *diffFile != "" && *diffFile != *diffBaseline {
+			fmt.Fprintf(os.Stderr, "Error: -diff-baseline %s cannot be used with -diff %s\n", *diffBaseline, *diffFile)
+			os.Exit(1)
+		}
+		*diffFile = *diffBaseline
+	}
+
+	if *minDepth < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -min-depth must not be negative\n")
+		os.Exit(1)
+	}
+	if *minDepth > 0 && !*flat && *top == 0 {
+		fmt.Fprintf(os.Stderr, "Error: -min-depth requires -flat or -top\n")
+		os.Exit(1)
+	}
+
+	textOpts := TextOptions{BOM: *bom, CRLF: *crlf}
+	if *bom || *crlf {
+		switch {
+		case *csvOutput == "" && *outputFile == "":
+			fmt.Fprintf(os.Stderr, "Error: -bom and -crlf require -csv or -output\n")
+			os.Exit(1)
+		case *outputFile != "" && format != "tree" && format != "csv" && format != "tsv" && format != "md":
+			// JSON parsers reject a BOM, and HTML has no use for either
+			fmt.Fprintf(os.Stderr, "Error: -bom and -crlf cannot be used with -format %s\n", format)
+			os.Exit(1)
+		case *crlf && *csvOutput == "" && format != "csv":
+			fmt.Fprintf(os.Stderr, "Error: -crlf requires -csv or -format csv\n")
+			os.Exit(1)
+		}
+	}
+
+	if *timeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -timeout must not be negative\n")
+		os.Exit(1)
+	}
+
+	if *stream {
+		// No tree is built, so only the plain list of totals can be written
+		flag.Visit(func(f *flag.Flag) {
+			if given[f.Name] && !streamFlags[f.Name] {
+				fmt.Fprintf(os.Stderr, "Error: -stream cannot be used with -%s\n", f.Name)
+				os.Exit(1)
+			}
+		})
+		if format != "tree" {
+			fmt.Fprintf(os.Stderr, "Error: -stream cannot be used with -format %s\n", format)
+			os.Exit(1)
+		}
+	}
+
+	if *quiet {
+		switch {
+		case format != "tree":
+			fmt.Fprintf(os.Stderr, "Error: -quiet cannot be used with -format %s\n", format)
+			os.Exit(1)
+		case *tui:
+			fmt.Fprintf(os.Stderr, "Error: -quiet cannot be used with -tui\n")
+			os.Exit(1)
+		case *dumpData != "" || *csvOutput != "" || *saveFile != "" || *sizeMap != "" || *treemapOutput != "":
+			// Their "saved to" notes would end up next to the total
+			fmt.Fprintf(os.Stderr, "Error: -quiet cannot be used with -dump-data, -csv, -save, -size-map or -treemap\n")
+			os.Exit(1)
+		}
+	} else if *rawBytes {
+		fmt.Fprintf(os.Stderr, "Error: -bytes requires -quiet\n")
+		os.Exit(1)
+	}
+
+	if *tui {
+		switch {
+		case format != "tree":
+			fmt.Fprintf(os.Stderr, "Error: -tui cannot be used with -format %s\n", format)
+			os.Exit(1)
+		case *outputFile != "":
+			fmt.Fprintf(os.Stderr, "Error: -tui cannot be used with -output\n")
+			os.Exit(1)
+		case *watch:
+			fmt.Fprintf(os.Stderr, "Error: -tui cannot be used with -watch\n")
+			os.Exit(1)
+		}
+	}
+
+	// -depth cuts the tree short as displayed; the list and aggregate
+	// modes cover the whole scan, so it would be ignored there
+	if *depth >= 0 && !*stream {
+		var mode string
+		switch {
+		case *top > 0:
+			mode = "-top"
+		case *byExt:
+			mode = "-by-ext"
+		case *histogram:
+			mode = "-histogram"
+		case *dupes:
+			mode = "-dupes"
+		case *empty:
+			mode = "-empty"
+		case *diffFile != "":
+			mode = "-diff"
+		case *compareDir != "":
+			mode = "-compare"
+		case *tui:
+			mode = "-tui"
+		case *hashOutput:
+			mode = "-hash-output"
+		case format == "csv" || format == "tsv" || format == "ndjson":
+			mode = "-format " + format
+		}
+		if mode != "" {
+			fmt.Fprintf(os.Stderr, "Error: -depth and -no-recurse only limit the tree and cannot be used with %s\n", mode)
+			os.Exit(1)
+		}
+	}
+
+	if *bothSizes && !*apparent {
+		fmt.Fprintf(os.Stderr, "Error: -show-both-sizes cannot be used with -apparent=false\n")
+		os.Exit(1)
+	}
+
+	if *hashOutput && *hashAlgo == "" {
+		fmt.Fprintf(os.Stderr, "Error: -hash-output requires -hash\n")
+		os.Exit(1)
+	}
+
+	for _, pattern := range slices.Concat(exclude, include, summarize) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid pattern '%s': %v\n", pattern, err)
+			os.Exit(1)
+		}
+	}
+
+	// Parse filesystem types to skip
+	opts := &ScanOptions{
+		MaxDepth:     *depth, // Only for -stream, the tree is cut when displayed
+		Retries:      *retries,
+		Summarize:    summarize,
+		Exclude:      exclude,
+		Include:      include,
+		Follow:       *follow,
+		Jobs:         *jobs,
+		SkipHidden:   *excludeHidden,
+		IntoArchives: *intoArchives,
+		GitIgnore:    *gitignoreRules,
+		CountLinks:   *countHardLinks,
+		Relative:     *relative,
+		ResolveRoot:  *resolveRoot,
+		DiskUsage:    !*apparent,
+		SameDevice:   *sameDevice,
+	}
+	if *olderThan != "" {
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -older-than value: %v\n", err)
+			os.Exit(1)
+		}
+		opts.OlderThan = age
+	}
+	if *newerThan != "" {
+		age, err := parseAge(*newerThan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -newer-than value: %v\n", err)
+			os.Exit(1)
+		}
+		opts.NewerThan = age
+	}
+	if opts.OlderThan > 0 && opts.NewerThan > 0 && opts.NewerThan <= opts.OlderThan {
+		fmt.Fprintf(os.Stderr, "Error: No file can be older than %s and newer than %s\n", *olderThan, *newerThan)
+		os.Exit(1)
+	}
+	if *nameRegexp != "" {
+		re, err := regexp.Compile(*nameRegexp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -regex pattern: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Regexp = re
+		opts.RegexpPath = *regexpPath
+	} else if *regexpPath {
+		fmt.Fprintf(os.Stderr, "Error: -regex-path requires -regex\n")
+		os.Exit(1)
+	}
+	if len(extensions) > 0 {
+		opts.Extensions = make(map[string]bool)
+		for _, ext := range extensions {
+			opts.Extensions["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+		}
+	}
+	if *progressJSON {
+		opts.Progress = os.Stderr
+	}
+	if *skipFSTypes != "" {
+		if !fsTypeSupported {
+			fmt.Fprintf(os.Stderr, "Warning: -skip-fstypes is not supported on this platform, ignoring\n")
+		} else {
+			types, err := parseFSTypes(*skipFSTypes)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts.SkipFSTypes = types
+		}
+	}
+
+	if *hashAlgo != "" {
+		newHash, ok := hashAlgorithms[strings.ToLower(*hashAlgo)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: Invalid hash algorithm '%s'. Use one of: %s\n",
+				*hashAlgo, strings.Join(hashAlgorithmNames(), ", "))
+			os.Exit(1)
+		}
+		opts.Hash = newHash
+	}
+
+	var limit int64 = -1
+	if *ignoreOver != "" {
+		var err error
+		limit, err = parseSize(*ignoreOver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -ignore-over value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	switch *entryType {
+	case "", "f", "d":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid -type '%s'. Use 'f' for files or 'd' for directories\n", *entryType)
+		os.Exit(1)
+	}
+
+	// -prune-empty is on by default when a filter may leave directories
+	// without files
+	pruneEmptySet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "prune-empty" {
+			pruneEmptySet = true
+		}
+	})
+	if !pruneEmptySet {
+		*pruneEmpty = *ignoreOver != "" || *minSize != "" || *entryType == "f" || len(extensions) > 0 ||
+			len(include) > 0 || *nameRegexp != "" || *olderThan != "" || *newerThan != ""
+	}
+
+	var minLimit int64
+	if *minSize != "" {
+		var err error
+		minLimit, err = parseSize(*minSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -min-size value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var collapseBelowSize int64
+	if *collapseBelow != "" {
+		var err error
+		collapseBelowSize, err = parseSize(*collapseBelow)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -collapse-below value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	largeSize, err := parseSize(*largeThreshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid -large-threshold value: %v\n", err)
+		os.Exit(1)
+	}
+
+	style := treeStyleFor(*ascii, *noTree)
+	jsonOpts := JSONOptions{Legacy: *legacyJSON, Compact: *compactJSON}
+
+	var baseline []*JSONFileInfo
+	if *diffFile != "" {
+		baseline, err = loadScan(*diffFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	bounds := defaultBuckets
+	if len(buckets) > 0 {
+		bounds, err = parseBuckets(buckets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -buckets value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var minDupe int64
+	if *dupes {
+		var err error
+		minDupe, err = parseSize(*minDupeSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid -min-dupe-size value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *stream {
+		status := streamOutput(targetDirs, *outputFile, opts, sizeFormat, *verbose)
+		if status == 0 && len(stdinSkipped) > 0 {
+			status = exitPartial
+		}
+		if status != 0 {
+			os.Exit(status)
+		}
+		return
+	}
+
+	// scanAndPrint scans every target directory and writes the selected
+	// output, returning the exit status: 0, exitPartial if some entries
+	// couldn't be read or exitStopped if the scan was cut short. Watch
+	// mode calls it again after each change.
+	scanAndPrint := func() int {
+		partial := len(stdinSkipped) > 0
+
+		// Ctrl-C during the scan stops it and prints what was found so
+		// far. A second Ctrl-C, or one after the scan, quits as usual.
+		interrupt, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-interrupt.Done()
+			stop()
+		}()
+		ctx := interrupt
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		// Build and sort one file tree per directory
+		roots := make([]*FileInfo, 0, len(targetDirs))
+		skipped := make([][]SkippedEntry, 0, len(targetDirs))
+		var scanTime time.Duration
+		var stopped error
+		for _, targetDir := range targetDirs {
+			start := time.Now()
+			root, stats, err := buildFileTree(ctx, targetDir, opts)
+			scanTime += time.Since(start)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error building file tree: %v\n", err)
+				os.Exit(1)
+			}
+			if stats.Recovered > 0 {
+				fmt.Fprintf(os.Stderr, "Recovered %d paths after retrying transient errors\n", stats.Recovered)
+			}
+			if stats.HashFailed > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: could not hash %s\n", pluralize(stats.HashFailed, "file"))
+				partial = true
+			}
+			skipped = append(skipped, stats.Skipped)
+
+			if limit >= 0 {
+				pruneLargeFiles(root, limit, *ignoreOverTotals)
+			}
+			if minLimit > 0 {
+				pruneSmallEntries(root, minLimit)
+			}
+			if *entryType != "" {
+				pruneByType(root, *entryType == "d")
+			}
+			if *pruneEmpty && *entryType != "d" {
+				pruneEmptyDirs(root, 0, *depth)
+			}
+
+			sortFileTree(root, sortType, *reverse)
+			roots = append(roots, root)
+			if stats.Stopped != nil {
+				stopped = stats.Stopped
+				break // The remaining directories aren't scanned at all
+			}
+		}
+		stop()
+		if *showStats {
+			printScanStats(os.Stderr, roots, scanTime, sizeFormat)
+		}
+
+		// Trees cut at -depth, and as displayed, with long directory
+		// listings cut short too. The list-style outputs (CSV, -top, ...)
+		// and the file exports still use every entry.
+		limited := roots
+		if *depth >= 0 {
+			limited = make([]*FileInfo, len(roots))
+			for i, root := range roots {
+				limited[i] = limitDepth(root, *depth)
+			}
+		}
+		display := limited
+		if *maxChildren > 0 {
+			display = make([]*FileInfo, len(roots))
+			for i, root := range limited {
+				display[i] = limitChildren(root, *maxChildren)
+			}
+		}
+
+		// Output
+		var out io.Writer = os.Stdout
+		var outBuf *bufio.Writer
+		var outFileHandle *os.File
+		if *outputFile != "" {
+			var err error
+			outFileHandle, err = os.Create(*outputFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+				os.Exit(1)
+			}
+			outBuf = bufio.NewWriter(outFileHandle)
+			out = outBuf
+			if textOpts.BOM {
+				io.WriteString(out, utf8BOM) // Errors show when flushing
+			}
+		}
+
+		wroteData := false
+		if *dumpData != "" {
+			err := writeTreeData(display, *dumpData, sizeFormat, jsonOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing tree data: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Tree data saved to: %s\n", *dumpData)
+			wroteData = true
+		}
+		if *csvOutput != "" {
+			err := writeCSV(roots, *csvOutput, sizeFormat, textOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("CSV output saved to: %s\n", *csvOutput)
+			wroteData = true
+		}
+		if *saveFile != "" {
+			err := saveScan(roots, *saveFile, sizeFormat, jsonOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving scan: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Scan saved to: %s\n", *saveFile)
+			wroteData = true
+		}
+		if *sizeMap != "" {
+			err := writeSizeMap(roots, *sizeMap, *sizeMapDirs)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing size map: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Size map saved to: %s\n", *sizeMap)
+			wroteData = true
+		}
+		if *treemapOutput != "" {
+			err := writeTreemap(display, *treemapOutput, strings.Join(targetDirs, ", "), sizeFormat, jsonOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing treemap: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Treemap saved to: %s\n", *treemapOutput)
+			wroteData = true
+		}
+		var err error
+		switch format {
+		case "json":
+			err = writeJSON(out, display, sizeFormat, *byExt, jsonOpts)
+		case "ndjson":
+			err = writeNDJSON(out, roots, sizeFormat)
+		case "csv":
+			err = writeCSVTo(out, roots, sizeFormat, textOpts.CRLF)
+		case "tsv":
+			err = writeTSV(out, roots)
+		case "html":
+			err = generateHTML(out, display, strings.Join(targetDirs, ", "), HTMLOptions{
+				Format:        sizeFormat,
+				SortType:      sortType,
+				Reverse:       *reverse,
+				CollapseOver:  *collapseOver,
+				CollapseBelow: collapseBelowSize,
+				Theme:         *theme,
+				JSON:          jsonOpts,
+			})
+		case "md":
+			err = writeMarkdown(out, display, sizeFormat)
+		default: // tree
+			if *tui {
+				err = runTUI(roots, sizeFormat)
+			} else if *quiet {
+				var total int64
+				for _, root := range roots {
+					total += root.Size
+				}
+				if *rawBytes {
+					fmt.Fprintln(out, total)
+				} else {
+					fmt.Fprintln(out, formatSize(total, sizeFormat))
+				}
+			} else if *byExt {
+				printExtensionStats(out, roots, sizeFormat)
+			} else if *flat {
+				printFlatDirs(out, entriesAt(limited, *minDepth), sizeFormat)
+			} else if *top > 0 {
+				printTopFiles(out, entriesAt(roots, *minDepth), *top, sizeFormat)
+			} else if *compareDir != "" {
+				if len(roots) < 2 {
+					// Stopped before the second tree was scanned
+					roots = append(roots, &FileInfo{IsDir: true})
+				}
+				printCompare(out, roots[0], roots[1], targetDirs[0], targetDirs[1], style, sizeFormat)
+			} else if baseline != nil {
+				printDiff(out, baseline, roots, sizeFormat)
+			} else if *histogram {
+				printHistogram(out, roots, bounds, sizeFormat)
+			} else if *empty {
+				printEmptyDirs(out, roots)
+			} else if *dupes {
+				groups, failed := findDuplicates(roots, minDupe)
+				if failed > 0 {
+					fmt.Fprintf(os.Stderr, "Warning: could not hash %s\n", pluralize(failed, "file"))
+					partial = true
+				}
+				printDuplicates(out, groups, sizeFormat)
+			} else if !wroteData {
+				color := useColor(*colorMode, out)
+				legend := false
+				for i, root := range roots {
+					if len(roots) > 1 {
+						if i > 0 {
+							fmt.Fprintln(out)
+						}
+						fmt.Fprintf(out, "==> %s <==\n", targetDirs[i])
+					}
+
+					if *hashOutput {
+						rootPath := root.Path
+						if !root.IsDir {
+							rootPath = filepath.Dir(root.Path) // List a lone file by name
+						}
+						printHashManifest(out, root, rootPath)
+					} else if *machineTree {
+						printMachineTree(out, limited[i], 0)
+					} else {
+						treeOpts := &TreeOptions{
+							Format:        sizeFormat,
+							ShowBothSizes: *bothSizes,
+							ShowTime:      *showTime,
+							ShowAge:       *showAge,
+							ShowPercent:   *percent,
+							MaxLines:      *maxLines,
+							Style:         style,
+							Align:         *align,
+							Collapse:      *collapse,
+							ShowMounts:    *mountSummary,
+							SummaryDepth:  *summaryDepth,
+							Color:         color,
+							LargeSize:     largeSize,
+						}
+						if *bars {
+							treeOpts.BarWidth = *barWidth
+						}
+						printFileTree(out, display[i], nil, "", true, treeOpts)
+						if treeOpts.truncated > 0 {
+							fmt.Fprintf(out, "... (output truncated, %d more lines)\n", treeOpts.truncated)
+						}
+						legend = color
+					}
+				}
+				if legend {
+					printColorLegend(out, largeSize, sizeFormat)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s output: %v\n", format, err)
+			os.Exit(1)
+		}
+
+		if outFileHandle != nil {
+			err := outBuf.Flush()
+			if closeErr := outFileHandle.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Output saved to: %s\n", *outputFile)
+		}
+
+		// Reported after the output so the warnings aren't scrolled away
+		for i, entries := range skipped {
+			if len(entries) == 0 {
+				continue
+			}
+			if len(roots) > 1 {
+				fmt.Fprintf(os.Stderr, "%s: ", targetDirs[i])
+			}
+			reportSkipped(os.Stderr, entries, *verbose)
+			partial = true
+		}
+		if errors.Is(stopped, context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "Warning: scan stopped after the -timeout of %s, the output is incomplete\n", *timeout)
+		} else if stopped != nil {
+			fmt.Fprintf(os.Stderr, "Warning: scan interrupted, the output is incomplete\n")
+		}
+
+		if *summary {
+			for i, root := range roots {
+				if !root.IsDir {
+					fmt.Fprintf(os.Stderr, "Total: %s in 1 file (%s)\n", formatSize(root.Size, sizeFormat), targetDirs[i])
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Total: %s across %s in %s (%s)\n", formatSize(root.Size, sizeFormat),
+					pluralizeCount(root.Count, "file", "files"), pluralizeCount(root.DirCount+1, "directory", "directories"), targetDirs[i])
+			}
+		}
+
+		if *disk {
+			for i, root := range roots {
+				total, free, err := volumeSpace(root.Path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: cannot query disk space of %s: %v\n", targetDirs[i], err)
+					continue
+				}
+				if len(roots) > 1 {
+					fmt.Fprintf(os.Stderr, "%s: ", targetDirs[i])
+				}
+				fmt.Fprintf(os.Stderr, "Scanned %s — %.0f%% of %s volume, %s free\n", formatSize(root.Size, sizeFormat),
+					float64(root.Size)/float64(max(total, 1))*100, formatSize(int64(total), sizeFormat), formatSize(int64(free), sizeFormat))
+			}
+		}
+
+		if *countLinks {
+			for i, root := range roots {
+				// The counts of -summary, of which the symlinks are a part
+				files, dirs, symlinks := 1, 0, 0
+				if root.IsDir {
+					files, dirs, symlinks = root.Count, root.DirCount+1, countSymlinks(root)
+				} else if root.IsSymlink {
+					symlinks = 1 // A lone symlink was scanned
+				}
+				if len(roots) > 1 {
+					fmt.Fprintf(os.Stderr, "%s: ", targetDirs[i])
+				}
+				fmt.Fprintf(os.Stderr, "Total: %s across %s (%s) in %s\n", formatSize(root.Size, sizeFormat),
+					pluralizeCount(files, "file", "files"), pluralizeCount(symlinks, "symlink", "symlinks"),
+					pluralizeCount(dirs, "directory", "directories"))
+			}
+		}
+
+		switch {
+		case stopped != nil:
+			return exitStopped
+		case partial:
+			return exitPartial
+		}
+		return 0
+	}
+
+	status := scanAndPrint()
+	if *watch {
+		outputs := []string{*outputFile, *csvOutput, *saveFile, *dumpData, *treemapOutput, *sizeMap}
+		err := watchDirs(targetDirs, opts, outputs, func() {
+			if *outputFile == "" && isTerminal(os.Stdout) {
+				fmt.Print(clearScreen)
+			}
+			status = scanAndPrint()
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching for changes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if status != 0 {
+		os.Exit(status)
+	}
+}
+
+// skipReason returns why an entry couldn't be read, without its path
+func skipReason(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// reportSkipped writes a one-line summary of the skipped entries grouped
+// by reason, e.g. "Warning: skipped 3 entries (permission denied)",
+// followed by each path when verbose is set
+func reportSkipped(w io.Writer, entries []SkippedEntry, verbose bool) {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[skipReason(entry.Err)]++
+	}
+	reasons := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(reasons, func(a, b string) int {
+		if c := cmp.Compare(counts[b], counts[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	var summary string
+	if len(reasons) == 1 {
+		summary = reasons[0]
+	} else {
+		parts := make([]string, len(reasons))
+		for i, reason := range reasons {
+			parts[i] = fmt.Sprintf("%d %s", counts[reason], reason)
+		}
+		summary = strings.Join(parts, ", ")
+	}
+	noun := "entries"
+	if len(entries) == 1 {
+		noun = "entry"
+	}
+	fmt.Fprintf(w, "Warning: skipped %d %s (%s)\n", len(entries), noun, summary)
+
+	if verbose {
+		for _, entry := range entries {
+			fmt.Fprintf(w, "  %s: %s\n", entry.Path, skipReason(entry.Err))
+		}
+	}
+}
+
+// readPathList reads newline-separated paths from r, skipping blank
+// lines and, with a warning, paths that don't exist, which are returned
+// as skipped
+func readPathList(r io.Reader) ([]string, []SkippedEntry) {
+	var paths []string
+	var skipped []SkippedEntry
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		path := strings.TrimSuffix(lines.Text(), "\r")
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping '%s': %v\n", path, skipReason(err))
+			skipped = append(skipped, SkippedEntry{Path: path, Err: err})
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if err := lines.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: reading paths from stdin: %v\n", err)
+	}
+	return paths, skipped
+}
+
+// parseFSTypes converts a comma-separated list of filesystem type names
+// into a set of statfs magic numbers
+func parseFSTypes(list string) (map[uint32]bool, error) {
+	types := make(map[uint32]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		magic, ok := fsTypeMagic[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filesystem type '%s'", name)
+		}
+		types[magic] = true
+	}
+	return types, nil
+}
+
+// buildFileTree scans rootPath into a tree. When ctx is done the walk
+// stops at the next entry, and the tree scanned so far is returned with
+// ScanStats.Stopped set.
+func buildFileTree(ctx context.Context, rootPath string, opts *ScanOptions) (*FileInfo, *ScanStats, error) {
+	absPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.ResolveRoot {
+		// Name and show the root after where its symlinks lead
+		if absPath, err = filepath.EvalSymlinks(absPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	root := &FileInfo{
+		Name:    filepath.Base(absPath),
+		Path:    absPath,
+		OutPath: absPath,
+	}
+	if info, err := os.Lstat(absPath); err == nil {
+		root.IsSymlink = info.Mode()&os.ModeSymlink != 0
+	}
+	// Known before the walk, so a scan stopped at once still shows a
+	// directory as one
+	if info, err := os.Stat(absPath); err == nil {
+		root.IsDir = info.IsDir()
+	}
+	if opts.Relative {
+		root.OutPath = "."
+		if !root.IsDir {
+			root.OutPath = root.Name // A lone file is shown by name
+		}
+	}
+
+	s := &scanner{opts: opts, links: make(map[fileID][]hardLink)}
+	if opts.Jobs > 1 {
+		s.slots = make(chan struct{}, opts.Jobs-1)
+	}
+	if opts.Progress != nil {
+		s.progress = newProgressReporter(opts.Progress)
+	}
+	if opts.Hash != nil {
+		s.hashes = newHashPool(opts.Hash)
+	}
+	// Ages are measured from the start of each scan, so -watch keeps up
+	now := time.Now()
+	if opts.OlderThan > 0 {
+		s.modifiedBefore = now.Add(-opts.OlderThan)
+	}
+	if opts.NewerThan > 0 {
+		s.modifiedAfter = now.Add(-opts.NewerThan)
+	}
+	err = s.buildFileTreeRecursive(ctx, root, 0, nil, nil)
+	s.stats.HashFailed = s.hashes.wait()
+	s.progress.finish()
+	s.stats.Stopped = ctx.Err()
+	if err != nil && s.stats.Stopped == nil {
+		return nil, nil, err
+	}
+	s.uncountHardLinks()
+	slices.SortFunc(s.stats.Skipped, func(a, b SkippedEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return root, &s.stats, nil
+}
+
+// wantsFile reports whether file passes the extension, -include and
+// -regex filters
+func (s *scanner) wantsFile(file *FileInfo) bool {
+	if s.opts.Extensions != nil && !s.opts.Extensions[fileExt(file.Name)] {
+		return false
+	}
+	if len(s.opts.Include) > 0 && !matchesAny(file.Name, s.opts.Include) {
+		return false
+	}
+	if s.opts.Regexp != nil {
+		subject := file.Name
+		if s.opts.RegexpPath {
+			subject = file.OutPath
+		}
+		return s.opts.Regexp.MatchString(subject)
+	}
+	return true
+}
+
+// filtering reports whether files are filtered by name or age
+func (s *scanner) filtering() bool {
+	return s.opts.Extensions != nil || len(s.opts.Include) > 0 || s.opts.Regexp != nil ||
+		s.opts.OlderThan > 0 || s.opts.NewerThan > 0
+}
+
+// wantsModTime reports whether a file modified at t passes the
+// -older-than and -newer-than filters
+func (s *scanner) wantsModTime(t time.Time) bool {
+	if !s.modifiedBefore.IsZero() && !t.Before(s.modifiedBefore) {
+		return false
+	}
+	return s.modifiedAfter.IsZero() || t.After(s.modifiedAfter)
+}
+
+// fileExt returns the lowercase extension of name with its leading dot.
+// Dotfiles such as .bashrc have no extension.
+func fileExt(name string) string {
+	return strings.ToLower(filepath.Ext(strings.TrimPrefix(name, ".")))
+}
+
+// skip records an entry left out of the tree because of err
+func (s *scanner) skip(path string, err error) {
+	s.mu.Lock()
+	s.stats.Skipped = append(s.stats.Skipped, SkippedEntry{Path: path, Err: err})
+	s.mu.Unlock()
+}
+
+// uncountHardLinks keeps the size of each hard-linked file only at its
+// first path in lexical order, so the result doesn't depend on which
+// link the parallel walk reached first, and takes the other links' sizes
+// back out of their directories' totals
+func (s *scanner) uncountHardLinks() {
+	for _, links := range s.links {
+		slices.SortFunc(links, func(a, b hardLink) int {
+			return strings.Compare(a.node.Path, b.node.Path)
+		})
+		for _, link := range links[1:] {
+			for a := link.parents; a != nil; a = a.parent {
+				a.node.Size -= link.node.Size
+				a.node.DiskSize -= link.node.DiskSize
+			}
+			link.node.Size, link.node.DiskSize = 0, 0
+			link.node.HardLink = true
+		}
+	}
+}
+
+// acquireSlot claims a spare walker goroutine if one is free
+func (s *scanner) acquireSlot() bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *scanner) releaseSlot() {
+	<-s.slots
+}
+
+// matchesAny reports whether name matches one of the filepath.Match patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scanner) buildFileTreeRecursive(ctx context.Context, node *FileInfo, depth int, ancestors *ancestor, ignores *gitignore) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Symlinks count as the links themselves unless following them.
+	// The scan root is always resolved.
+	stat := os.Lstat
+	if s.opts.Follow || depth == 0 {
+		stat = os.Stat
+	}
+
+	var info os.FileInfo
+	err := s.withRetry(ctx, func() (err error) {
+		info, err = stat(node.Path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	node.IsDir = info.IsDir()
+	node.ModTime = info.ModTime()
+	if node.IsSymlink {
+		node.LinkTarget, _ = os.Readlink(node.Path)
+	}
+	s.progress.update(node.Path)
+
+	if node.IsDir {
+		// A device change from the parent directory marks a mount point
+		if dev, ok := deviceID(info); ok {
+			node.Device = dev
+			node.IsMount = ancestors != nil && ancestors.node.Device != dev
+		}
+	}
+
+	if node.IsDir {
+		var realPath string
+		if s.opts.Follow {
+			// Break cycles from symlinks pointing back up the tree
+			if resolved, err := filepath.EvalSymlinks(node.Path); err == nil {
+				if ancestors.contains(resolved) {
+					fmt.Fprintf(os.Stderr, "Warning: skipping symlink loop at %s\n", node.Path)
+					return errSymlinkLoop
+				}
+				realPath = resolved
+			}
+		}
+		ancestors = &ancestor{node: node, realPath: realPath, parent: ancestors}
+	}
+
+	if node.IsDir && matchesAny(node.Name, s.opts.Summarize) {
+		node.Summarized = true
+	}
+
+	if node.IsDir && s.opts.SameDevice {
+		// Stay on the target's filesystem so network shares, bind mounts
+		// and other disks mounted below it aren't counted as its usage.
+		// The mount point itself is listed, with no contents.
+		if dev, ok := deviceID(info); ok {
+			if depth == 0 {
+				s.rootDev = dev
+			} else if dev != s.rootDev {
+				return nil
+			}
+		}
+	}
+
+	if node.IsDir && len(s.opts.SkipFSTypes) > 0 {
+		// Don't descend into pseudo-filesystems such as /proc
+		if fsType, err := fsTypeOf(node.Path); err == nil && s.opts.SkipFSTypes[fsType] {
+			return nil
+		}
+	}
+
+	if node.IsDir {
+		var entries []os.DirEntry
+		err := s.withRetry(ctx, func() (err error) {
+			entries, err = os.ReadDir(node.Path)
+			return err
+		})
+		if err != nil {
+			if len(entries) == 0 {
+				return err
+			}
+			// Reading stopped partway, keep the entries we got
+			node.Skipped++
+			s.skip(node.Path, err)
+		}
+
+		if s.opts.GitIgnore {
+			ignores = loadGitignore(node.Path, ignores)
+		}
+
+		var children []*FileInfo
+		var subdirs []bool
+		for _, entry := range entries {
+			// Excluded entries are neither descended into nor counted
+			if matchesAny(entry.Name(), s.opts.Exclude) {
+				continue
+			}
+			if s.opts.SkipHidden && strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			childPath := filepath.Join(node.Path, entry.Name())
+			if ignores.ignored(childPath, entry.IsDir()) {
+				continue
+			}
+			outPath := childPath
+			if s.opts.Relative {
+				outPath = path.Join(node.OutPath, entry.Name())
+			}
+			child := &FileInfo{
+				Name:      entry.Name(),
+				Path:      childPath,
+				OutPath:   outPath,
+				IsSymlink: entry.Type()&os.ModeSymlink != 0,
+			}
+			if entry.Type().IsRegular() && !s.wantsFile(child) {
+				continue // Don't bother stating or hashing it
+			}
+			children = append(children, child)
+			subdirs = append(subdirs, entry.IsDir())
+		}
+
+		// Walk subdirectories on spare goroutines while any are free,
+		// otherwise inline, so the number of walkers stays bounded
+		errs := make([]error, len(children))
+		var wg sync.WaitGroup
+		for i, child := range children {
+			if subdirs[i] && s.acquireSlot() {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer s.releaseSlot()
+					errs[i] = s.buildFileTreeRecursive(ctx, child, depth+1, ancestors, ignores)
+				}()
+				continue
+			}
+			errs[i] = s.buildFileTreeRecursive(ctx, child, depth+1, ancestors, ignores)
+		}
+		wg.Wait()
+
+		// Aggregate in directory order so the result doesn't depend on
+		// which goroutine finished first
+		var totalSize, totalDiskSize int64
+		var newest time.Time
+		for i, child := range children {
+			if errs[i] != nil && ctx.Err() != nil && errors.Is(errs[i], ctx.Err()) {
+				continue // Not reached before the scan was stopped
+			}
+			if errs[i] != nil {
+				node.Skipped++
+				s.skip(child.Path, errs[i])
+				continue // Skip files we can't read
+			}
+			// Directories left without files stay, -prune-empty decides
+			if s.filtering() && !child.IsDir && !(s.wantsFile(child) && s.wantsModTime(child.ModTime)) {
+				continue // Filtered out by name or age
+			}
+
+			totalSize += child.Size
+			totalDiskSize += child.DiskSize
+			if child.Newest.After(newest) {
+				newest = child.Newest
+			}
+			if child.IsDir {
+				node.Count += child.Count
+				node.DirCount += 1 + child.DirCount
+			} else {
+				node.Count++
+			}
+			node.Children = append(node.Children, child)
+		}
+		node.Size = totalSize
+		node.DiskSize = totalDiskSize
+		node.Newest = newest
+		if newest.IsZero() {
+			node.Newest = node.ModTime // Nothing below it, so its own change counts
+		}
+	} else {
+		node.Newest = node.ModTime
+		node.Size = info.Size()
+		node.DiskSize = diskUsage(info)
+		if s.opts.DiskUsage {
+			node.Size = node.DiskSize
+		}
+		if info.Mode().IsRegular() {
+			s.hashes.add(node) // Unfollowed symlinks and devices have no contents to hash
+		}
+		if format := archiveFormat(node.Name); s.opts.IntoArchives && format != "" {
+			if err := s.readArchive(ctx, node, format); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				// Still counted, as a plain file
+				fmt.Fprintf(os.Stderr, "Warning: cannot read archive %s: %v\n", node.Path, err)
+			}
+		}
+		if id, ok := hardLinkID(info); ok && !s.opts.CountLinks && s.wantsFile(node) && s.wantsModTime(node.ModTime) {
+			s.mu.Lock()
+			s.links[id] = append(s.links[id], hardLink{node: node, parents: ancestors})
+			s.mu.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// pruneLargeFiles removes files larger than limit below node. When
+// adjustTotals is set, the removed bytes are also subtracted from every
+// ancestor's size so totals reflect only the remaining files.
+func pruneLargeFiles(node *FileInfo, limit int64, adjustTotals bool) (removed, removedDisk int64, removedCount int) {
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if !child.IsDir && child.Size > limit {
+			removed += child.Size
+			removedDisk += child.DiskSize
+			removedCount++
+			continue
+		}
+		if child.IsDir {
+			r, rd, rc := pruneLargeFiles(child, limit, adjustTotals)
+			removed += r
+			removedDisk += rd
+			removedCount += rc
+		}
+		kept = append(kept, child)
+	}
+	node.Children = kept
+
+	if adjustTotals {
+		node.Size -= removed
+		node.DiskSize -= removedDisk
+		node.Count -= removedCount
+	}
+	return removed, removedDisk, removedCount
+}
+
+// countSymlinks counts the symlinks below node, not including node
+// itself. They are also among the files of node.Count.
+func countSymlinks(node *FileInfo) int {
+	symlinks := 0
+	for _, child := range node.Children {
+		if child.IsSymlink {
+			symlinks++
+		}
+		if !child.IsArchive { // Its entries aren't on disk
+			symlinks += countSymlinks(child)
+		}
+	}
+	return symlinks
+}
+
+// naturalCompare compares strings like strings.Compare, except that runs
+// of ASCII digits compare by numeric value, so img2 sorts before img10.
+// Numbers differing only in leading zeros compare equal.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, nb := digitRun(a), digitRun(b)
+			da, db := strings.TrimLeft(a[:na], "0"), strings.TrimLeft(b[:nb], "0")
+			if c := cmp.Compare(len(da), len(db)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(da, db); c != 0 {
+				return c
+			}
+			a, b = a[na:], b[nb:]
+			continue
+		}
+		// UTF-8 byte order is code point order, so bytes compare like runes
+		if a[0] != b[0] {
+			return cmp.Compare(a[0], b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// naturalLess reports whether a sorts before b in natural order
+func naturalLess(a, b string) bool {
+	return naturalCompare(a, b) < 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitRun returns the length of the run of digits at the start of s
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+// sortFileTree orders every directory's children in place. The ordering is
+// total (see compareFileInfo) and doesn't depend on the previous order, so
+// an already built tree can be re-sorted by any key, any number of times,
+// without walking the filesystem again.
+func sortFileTree(root *FileInfo, sortType SortType, reverse bool) {
+	if root == nil || len(root.Children) == 0 {
+		return
+	}
+
+	// Recursively sort child directories and archives
+	for _, child := range root.Children {
+		if child.IsDir || child.IsArchive {
+			sortFileTree(child, sortType, reverse)
+		}
+	}
+
+	// Sort current level
+	slices.SortFunc(root.Children, func(a, b *FileInfo) int {
+		return compareFileInfo(a, b, sortType, reverse)
+	})
+}
+
+// compareFileInfo orders two siblings, breaking ties by name and then by
+// path so the order is fully deterministic. The compareNodes function in
+// the HTML output mirrors it so a browser re-sort matches the terminal.
+func compareFileInfo(a, b *FileInfo, sortType SortType, reverse bool) int {
+	var result int
+	switch sortType {
+	case SortBySize:
+		// For size sorting, don't prioritize folders
+		result = -cmp.Compare(a.Size, b.Size) // Size descending
+	case SortByMtime:
+		result = -a.ModTime.Compare(b.ModTime) // Newest first
+	case SortByCount:
+		result = -cmp.Compare(fileCount(a), fileCount(b)) // Most files first
+	default: // SortByName, SortByNatural, SortByExt
+		// For name sorting, folders first regardless of order
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		if sortType == SortByNatural {
+			result = naturalCompare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		} else if sortType == SortByExt && !a.IsDir {
+			result = strings.Compare(fileExt(a.Name), fileExt(b.Name)) // No extension first
+		}
+	}
+
+	if result == 0 {
+		result = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) // Name ascending
+	}
+	if result == 0 {
+		result = strings.Compare(a.Path, b.Path)
+	}
+
+	if reverse {
+		return -result
+	}
+	return result
+}
+
+// fileCount returns the number of files node stands for: those below it
+// for a directory, 1 for a file
+func fileCount(node *FileInfo) int {
+	if node.IsDir {
+		return node.Count
+	}
+	return 1
+}
+
+// treeStyle is the indentation printFileTree draws in front of entries
+type treeStyle struct {
+	branch     string // Connects an entry that has siblings below it
+	lastBranch string // Connects the last entry of a directory
+	indent     string // Continues the prefix below an entry with siblings below it
+	lastIndent string // Continues the prefix below the last entry
+	barFull    string // Filled part of a -bars bar
+	barEmpty   string // Empty part of a -bars bar
+}
+
+var (
+	boxTree   = treeStyle{branch: "├── ", lastBranch: "└── ", indent: "│   ", lastIndent: "    ", barFull: "█", barEmpty: "░"}
+	asciiTree = treeStyle{branch: "|-- ", lastBranch: "`-- ", indent: "|   ", lastIndent: "    ", barFull: "#", barEmpty: "."} // -ascii
+)
+
+// treeStyleFor returns the style for the -ascii and -no-tree flags.
+// Plain indentation keeps the bar characters of the chosen style.
+func treeStyleFor(ascii, plain bool) treeStyle {
+	style := boxTree
+	if ascii {
+		style = asciiTree
+	}
+	if plain {
+		style.branch, style.lastBranch = "", ""
+		style.indent, style.lastIndent = "  ", "  "
+	}
+	return style
+}
+
+// printFileTree prints node and its children as an indented tree. parent
+// is nil for the root.
+func printFileTree(w io.Writer, node, parent *FileInfo, prefix string, isLast bool, opts *TreeOptions) {
+	if node == nil {
+		return
+	}
+
+	if parent == nil {
+		opts.rootSize = node.Size
+		opts.now = time.Now()
+	}
+
+	style := opts.Style
+
+	// Print current node
+	var connector string
+	if parent == nil {
+		connector = ""
+	} else if isLast {
+		connector = style.lastBranch
+	} else {
+		connector = style.branch
+	}
+
+	// A chain of directories each holding only the next is shown as one
+	// line with the innermost one's figures, e.g. a/b/c/ (1.2 KB, 1 file)
+	top := node
+	name := node.Name
+	if opts.Collapse {
+		for collapsible(node) {
+			node = node.Children[0]
+			name += "/" + node.Name
+		}
+	}
+
+	line := treeLine{indent: prefix + connector, name: name}
+	line.size = formatSize(node.Size, opts.Format)
+	if opts.ShowBothSizes {
+		// Disk > apparent hints at block overhead, apparent > disk at sparse files
+		line.size = fmt.Sprintf("%s apparent, %s disk", line.size, formatSize(node.DiskSize, opts.Format))
+	}
+	if node.IsDir {
+		line.details = append(line.details, pluralize(node.Count, "file"))
+	}
+	if opts.ShowTime && node.Omitted == 0 {
+		line.details = append(line.details, node.ModTime.Format(time.RFC3339))
+	}
+	if node.Summarized {
+		line.details = append(line.details, "summarized")
+	}
+	if node.HardLink {
+		line.details = append(line.details, "hard link")
+	}
+	if node.Skipped > 0 {
+		// Distinguish an empty directory from one we couldn't fully read
+		line.details = append(line.details, fmt.Sprintf("partial: %d skipped", node.Skipped))
+	}
+	if node.IsDir {
+		line.name += "/"
+	}
+	if node.LinkTarget != "" {
+		line.name += " -> " + node.LinkTarget
+	}
+	if node.IsArchive {
+		line.name += " [archive]"
+		line.details = append(line.details, pluralize(node.Count, "file"), formatSize(node.ArchiveSize, opts.Format)+" uncompressed")
+	}
+	if opts.ShowMounts && node.IsMount {
+		line.name += " [mount]"
+		if total, _, err := volumeSpace(node.Path); err == nil && total > 0 { // Pseudo filesystems report 0
+			line.details = append(line.details, formatSize(int64(total), opts.Format)+" volume")
+		}
+	}
+	if opts.Color {
+		switch {
+		case node.IsDir:
+			line.nameColor = ansiBoldBlue
+		case node.Size >= opts.LargeSize:
+			line.nameColor = ansiRed
+		}
+	}
+	if opts.ShowAge && node.Omitted == 0 {
+		age := opts.now.Sub(node.Newest)
+		line.age = formatAge(age)
+		if opts.Color {
+			line.ageColor = ageColor(age)
+		}
+	}
+	if opts.BarWidth > 0 {
+		line.bar = sizeBar(node.Size, opts.rootSize, opts.BarWidth, style)
+	}
+	if opts.ShowPercent {
+		line.percent = fmt.Sprintf("[%.1f%%]", percentOfParent(top, parent))
+	}
+	opts.emit(w, line)
+
+	// Print child nodes
+	if len(node.Children) > 0 && !node.Summarized {
+		var newPrefix string
+		if isLast {
+			newPrefix = prefix + style.lastIndent
+		} else {
+			newPrefix = prefix + style.indent
+		}
+
+		if opts.SummaryDepth >= 0 && opts.depth >= opts.SummaryDepth {
+			// Too deep to list, but still show what the directory holds
+			summary := treeLine{
+				indent:  newPrefix + style.lastBranch,
+				name:    "...",
+				size:    "contents: " + formatSize(node.Size, opts.Format),
+				details: []string{pluralizeCount(node.Count, "file", "files")},
+				bar:     line.bar,
+			}
+			if node.DirCount > 0 {
+				summary.details = append(summary.details, pluralizeCount(node.DirCount, "directory", "directories"))
+			}
+			opts.emit(w, summary)
+		} else {
+			opts.depth++
+			for i, child := range node.Children {
+				isChildLast := i == len(node.Children)-1
+				printFileTree(w, child, node, newPrefix, isChildLast, opts)
+			}
+			opts.depth--
+		}
+	}
+
+	if parent == nil && opts.Align {
+		// Every line is known now, so the size column can be placed
+		var widths treeColumns
+		for _, line := range opts.lines {
+			widths.tree = max(widths.tree, runewidth.StringWidth(line.indent+line.name))
+			widths.size = max(widths.size, len(line.size))
+			widths.details = max(widths.details, len(line.detailsText()))
+			widths.age = max(widths.age, len(line.age))
+		}
+		for _, line := range opts.lines {
+			fmt.Fprintln(w, line.format(opts.Color, &widths))
+		}
+		opts.lines = nil
+	}
+}
+
+// emit prints line, or with Align holds it back until the column widths
+// are known. Past MaxLines, the line is only counted.
+func (opts *TreeOptions) emit(w io.Writer, line treeLine) {
+	switch {
+	case opts.MaxLines > 0 && opts.printed >= opts.MaxLines:
+		// Keep walking so the truncation summary can say how much was left out
+		opts.truncated++
+	case opts.Align:
+		opts.lines = append(opts.lines, line)
+		opts.printed++
+	default:
+		fmt.Fprintln(w, line.format(opts.Color, nil))
+		opts.printed++
+	}
+}
+
+// collapsible reports whether -collapse merges node with its only
+// child: a plain directory holding nothing but one subdirectory
+func collapsible(node *FileInfo) bool {
+	if !node.IsDir || node.IsSymlink || node.Summarized || node.Skipped > 0 || len(node.Children) != 1 {
+		return false
+	}
+	child := node.Children[0]
+	return child.IsDir && !child.IsSymlink && child.Omitted == 0
+}
+
+// treeLine is one entry of the text tree, split into the parts that
+// -align lines up in columns
+type treeLine struct {
+	bar       string   // Share of the total size, empty without -bars
+	indent    string   // Connectors or spaces in front of the name
+	name      string   // Name with a trailing slash for directories
+	nameColor string   // ANSI code the name is highlighted with, if any
+	size      string   // Formatted size
+	details   []string // File count, time and other notes after the size
+	age       string   // Time since the last change, empty without -age
+	ageColor  string   // ANSI code the age is shown in, if any
+	percent   string   // Share of the parent, empty without -percent
+}
+
+// treeColumns are the widths -align pads the parts of each line to
+type treeColumns struct {
+	tree    int // Widest indent and name
+	size    int // Longest size
+	details int // Longest details in parentheses
+	age     int // Longest age
+}
+
+// detailsText returns the details in parentheses, or "" if there are none
+func (l treeLine) detailsText() string {
+	if len(l.details) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(l.details, ", ") + ")"
+}
+
+// format renders the line. With widths, the name is padded to the tree
+// column and the size right-justified in its own column, so sizes line
+// up; otherwise the size follows the name directly, e.g. main.go (1.2 KB).
+func (l treeLine) format(color bool, widths *treeColumns) string {
+	var b strings.Builder
+	if l.bar != "" {
+		// Bars go first so they line up at every depth
+		b.WriteString(l.bar + "  ")
+	}
+	b.WriteString(l.indent)
+
+	// Only the name and size are wrapped in colors, so connectors stay aligned
+	gray := func(s string) string {
+		if color {
+			return ansiGray + s + ansiReset
+		}
+		return s
+	}
+	if l.nameColor != "" {
+		b.WriteString(l.nameColor + l.name + ansiReset)
+	} else {
+		b.WriteString(l.name)
+	}
+
+	if widths != nil {
+		padding := widths.tree - runewidth.StringWidth(l.indent+l.name)
+		b.WriteString(strings.Repeat(" ", padding+2))
+		b.WriteString(gray(fmt.Sprintf("%*s", widths.size, l.size)))
+		details := l.detailsText()
+		if details != "" {
+			b.WriteString("  " + gray(details))
+		}
+		if (l.age != "" || l.percent != "") && widths.details > 0 {
+			// Keep the ages and percentages in columns of their own too
+			b.WriteString(strings.Repeat(" ", widths.details-len(details)))
+			if details == "" {
+				b.WriteString("  ")
+			}
+		}
+		if widths.age > 0 && (l.age != "" || l.percent != "") {
+			b.WriteString(" " + l.colorAge(color))
+			if l.percent != "" {
+				b.WriteString(strings.Repeat(" ", widths.age-len(l.age)))
+			}
+		}
+	} else {
+		b.WriteString(" " + gray("("+strings.Join(append([]string{l.size}, l.details...), ", ")+")"))
+		if l.age != "" {
+			b.WriteString(" " + l.colorAge(color))
+		}
+	}
+
+	if l.percent != "" {
+		b.WriteString(" " + l.percent)
+	}
+	return b.String()
+}
+
+// colorAge returns the age, in its color when color is set
+func (l treeLine) colorAge(color bool) string {
+	if color && l.ageColor != "" {
+		return l.ageColor + l.age + ansiReset
+	}
+	return l.age
+}
+
+// formatAge renders how long ago something changed in its largest unit,
+// e.g. 45s, 12m, 2h, 12d, 3mo or 2y
+func formatAge(age time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", max(int(age.Seconds()), 0))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < day:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	case age < 30*day:
+		return fmt.Sprintf("%dd", int(age/day))
+	case age < 365*day:
+		return fmt.Sprintf("%dmo", int(age/(30*day)))
+	default:
+		return fmt.Sprintf("%dy", int(age/(365*day)))
+	}
+}
+
+// ageColors run from green to red in the 256-color palette
+var ageColors = []int{46, 82, 118, 154, 190, 226, 220, 214, 208, 202, 196}
+
+// ageColor returns the ANSI code for age on a gradient from green for an
+// hour or less to red for five years or more, on a log scale
+func ageColor(age time.Duration) string {
+	const newest, oldest = time.Hour, 5 * 365 * 24 * time.Hour
+	position := 0.0
+	if age > newest {
+		position = min(math.Log(float64(age)/float64(newest))/math.Log(float64(oldest)/float64(newest)), 1)
+	}
+	return fmt.Sprintf("\x1b[38;5;%dm", ageColors[int(math.Round(position*float64(len(ageColors)-1)))])
+}
+
+// collectFiles appends every file below node to files, ignoring directories
+func collectFiles(node *FileInfo, files []*FileInfo) []*FileInfo {
+	if !node.IsDir {
+		return append(files, node)
+	}
+	for _, child := range node.Children {
+		files = collectFiles(child, files)
+	}
+	return files
+}
+
+// extensionStats totals the files across all trees by extension,
+// largest first
+func extensionStats(roots []*FileInfo, f SizeFormat) []ExtensionStat {
+	var files []*FileInfo
+	for _, root := range roots {
+		files = collectFiles(root, files)
+	}
+
+	byExt := make(map[string]*ExtensionStat)
+	var total int64
+	for _, file := range files {
+		ext := fileExt(file.Name)
+		if ext == "" {
+			ext = "(none)"
+		}
+		stat := byExt[ext]
+		if stat == nil {
+			stat = &ExtensionStat{Extension: ext}
+			byExt[ext] = stat
+		}
+		stat.Size += file.Size
+		stat.FileCount++
+		total += file.Size
+	}
+
+	stats := make([]ExtensionStat, 0, len(byExt))
+	for _, stat := range byExt {
+		stat.SizeStr = formatSize(stat.Size, f)
+		if total > 0 {
+			stat.Percent = float64(stat.Size) / float64(total) * 100
+		}
+		stats = append(stats, *stat)
+	}
+	slices.SortFunc(stats, func(a, b ExtensionStat) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Extension, b.Extension)
+	})
+	return stats
+}
+
+// printExtensionStats prints the per-extension totals as a table
+func printExtensionStats(w io.Writer, roots []*FileInfo, f SizeFormat) {
+	fmt.Fprintf(w, "%-12s %12s %8s %8s\n", "Extension", "Size", "Files", "Percent")
+	for _, stat := range extensionStats(roots, f) {
+		fmt.Fprintf(w, "%-12s %12s %8d %7.1f%%\n", stat.Extension, stat.SizeStr, stat.FileCount, stat.Percent)
+	}
+}
+
+// entriesAt returns the entries depth levels below the roots, the roots
+// themselves for 0. The list modes start from them to leave out the
+// entries above -min-depth.
+func entriesAt(roots []*FileInfo, depth int) []*FileInfo {
+	for ; depth > 0; depth-- {
+		var next []*FileInfo
+		for _, node := range roots {
+			next = append(next, node.Children...)
+		}
+		roots = next
+	}
+	return roots
+}
+
+// collectDirs appends node and every directory below it to dirs, without
+// descending into summarized directories
+func collectDirs(node *FileInfo, dirs []*FileInfo) []*FileInfo {
+	if !node.IsDir {
+		return dirs
+	}
+	dirs = append(dirs, node)
+	if node.Summarized {
+		return dirs
+	}
+	for _, child := range node.Children {
+		dirs = collectDirs(child, dirs)
+	}
+	return dirs
+}
+
+// printFlatDirs prints every directory across all trees with its total
+// size and full path, largest first
+func printFlatDirs(w io.Writer, roots []*FileInfo, f SizeFormat) {
+	var dirs []*FileInfo
+	for _, root := range roots {
+		dirs = collectDirs(root, dirs)
+	}
+
+	slices.SortFunc(dirs, func(a, b *FileInfo) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	for _, dir := range dirs {
+		fmt.Fprintf(w, "%12s  %s\n", formatSize(dir.Size, f), dir.OutPath)
+	}
+}
+
+// EmptyDir is a directory holding no files, possibly in subdirectories
+type EmptyDir struct {
+	Dir     *FileInfo
+	Subdirs int // Empty directories nested inside, 0 if truly empty
+}
+
+// collectEmptyDirs appends the directories below node, or node itself,
+// that contain no files. Directories the scan counted no files in are
+// read again in full, so entries left out by -exclude, -include and the
+// like, keep them from being reported. Only the
+// outermost of nested empty directories is listed.
+func collectEmptyDirs(node *FileInfo, dirs []EmptyDir) []EmptyDir {
+	if !node.IsDir || node.IsSymlink {
+		return dirs
+	}
+	if node.Count == 0 && node.Skipped == 0 {
+		if subdirs, ok := emptyOnDisk(node.Path); ok {
+			return append(dirs, EmptyDir{Dir: node, Subdirs: subdirs})
+		}
+	}
+	for _, child := range node.Children {
+		dirs = collectEmptyDirs(child, dirs)
+	}
+	return dirs
+}
+
+// emptyOnDisk reports whether dir holds nothing but directories that
+// are themselves empty, and how many of those there are
+func emptyOnDisk(dir string) (int, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, false
+	}
+	subdirs := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			return 0, false // Files, symlinks and devices all count as content
+		}
+		n, ok := emptyOnDisk(filepath.Join(dir, entry.Name()))
+		if !ok {
+			return 0, false
+		}
+		subdirs += 1 + n
+	}
+	return subdirs, true
+}
+
+// printEmptyDirs lists the empty directories across all trees in tree
+// order, telling truly empty ones from those with empty subdirectories
+func printEmptyDirs(w io.Writer, roots []*FileInfo) {
+	var dirs []EmptyDir
+	for _, root := range roots {
+		dirs = collectEmptyDirs(root, dirs)
+	}
+
+	for _, dir := range dirs {
+		if dir.Subdirs == 0 {
+			fmt.Fprintf(w, "%s/  (empty)\n", dir.Dir.OutPath)
+		} else {
+			fmt.Fprintf(w, "%s/  (only %s)\n", dir.Dir.OutPath,
+				pluralizeCount(dir.Subdirs, "empty subdirectory", "empty subdirectories"))
+		}
+	}
+	fmt.Fprintf(w, "%s\n", pluralizeCount(len(dirs), "empty directory", "empty directories"))
+}
+
+// printTopFiles prints the n largest files across all trees, largest
+// first, or every file if there are fewer than n
+func printTopFiles(w io.Writer, roots []*FileInfo, n int, f SizeFormat) {
+	var files []*FileInfo
+	for _, root := range roots {
+		files = collectFiles(root, files)
+	}
+
+	slices.SortFunc(files, func(a, b *FileInfo) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	for _, file := range files[:min(n, len(files))] {
+		fmt.Fprintf(w, "%12s  %s\n", formatSize(file.Size, f), file.OutPath)
+	}
+}
+
+// pluralizeCount is like pluralize for irregular plurals, and groups the
+// digits of n with commas, e.g. 1,234 files
+func pluralizeCount(n int, singular, plural string) string {
+	digits := strconv.Itoa(n)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if n == 1 {
+		return b.String() + " " + singular
+	}
+	return b.String() + " " + plural
+}
+
+// pluralize returns the count followed by noun, adding an s unless n is 1
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// machineNameEscaper keeps tabs and newlines in names from breaking
+// the line-oriented -machine-tree format
+var machineNameEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+// printMachineTree prints one depth<TAB>name<TAB>bytes line per node in
+// pre-order, so scripts can recover the structure without parsing connectors.
+// Directory names end with a slash.
+func printMachineTree(w io.Writer, node *FileInfo, depth int) {
+	if node == nil {
+		return
+	}
+
+	name := machineNameEscaper.Replace(node.Name)
+	if node.IsDir {
+		name += "/"
+	}
+	fmt.Fprintf(w, "%d\t%s\t%d\n", depth, name, node.Size)
+
+	if node.Summarized {
+		return
+	}
+	for _, child := range node.Children {
+		printMachineTree(w, child, depth+1)
+	}
+}
+
+// scaleSize splits size into the value and unit label formatSize shows:
+// the largest unit it reaches, or always f.Unit when a fixed unit is set
+// so columns stay comparable. The value is not rounded.
+func scaleSize(size int64, f SizeFormat) (float64, string) {
+	base := int64(1024)
+	if f.System == UnitsSI {
+		base = 1000
+	}
+	var (
+		KB = base
+		MB = base * KB
+		GB = base * MB
+		TB = base * GB
+	)
+	labels := unitLabels[f.System]
+
+	switch {
+	case f.Unit == "TB", f.Unit == "" && size >= TB:
+		return float64(size) / float64(TB), labels[4]
+	case f.Unit == "GB", f.Unit == "" && size >= GB:
+		return float64(size) / float64(GB), labels[3]
+	case f.Unit == "MB", f.Unit == "" && size >= MB:
+		return float64(size) / float64(MB), labels[2]
+	case f.Unit == "KB", f.Unit == "" && size >= KB:
+		return float64(size) / float64(KB), labels[1]
+	default:
+		return float64(size), labels[0]
+	}
+}
+
+// formatSize renders size with f.Precision decimals in its unit, or as a
+// whole number of bytes, e.g. 1.50 MB or 512 B
+func formatSize(size int64, f SizeFormat) string {
+	value, unit := scaleSize(size, f)
+	if unit == unitLabels[f.System][0] {
+		return fmt.Sprintf("%d %s", size, unit)
+	}
+	return fmt.Sprintf("%.*f %s", f.Precision, value, unit)
+}
+
+// roundTo rounds value to the given number of decimal places
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
+
+// parseUnit normalizes a -unit value such as kb, KiB or M to one of
+// B, KB, MB, GB or TB, independent of the unit system
+func parseUnit(unit string) (string, error) {
+	u := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(unit)), "B")
+	u = strings.TrimSuffix(u, "I")
+	switch u {
+	case "":
+		return "B", nil
+	case "K", "M", "G", "T":
+		return u + "B", nil
+	}
+	return "", fmt.Errorf("invalid unit '%s'. Use B, KB, MB, GB or TB", unit)
+}
+
+// limitDepth returns a copy of the tree below node without the entries
+// more than depth levels below it. Directories at the limit keep their
+// totals. node itself is left unchanged.
+func limitDepth(node *FileInfo, depth int) *FileInfo {
+	limited := *node
+	if depth == 0 {
+		limited.Children = nil
+		return &limited
+	}
+	limited.Children = make([]*FileInfo, len(node.Children))
+	for i, child := range node.Children {
+		limited.Children[i] = limitDepth(child, depth-1)
+	}
+	return &limited
+}
+
+// limitChildren returns a copy of the tree below node in which
+// directories with more than max entries keep only the first max, in
+// the current sort order, followed by a synthetic "... and N more" entry
+// holding the size of the rest. node itself is left unchanged.
+func limitChildren(node *FileInfo, max int) *FileInfo {
+	limited := *node
+	if !node.IsDir || len(node.Children) == 0 {
+		return &limited
+	}
+
+	shown := node.Children[:min(max, len(node.Children))]
+	limited.Children = make([]*FileInfo, 0, len(shown)+1)
+	for _, child := range shown {
+		limited.Children = append(limited.Children, limitChildren(child, max))
+	}
+
+	if rest := node.Children[len(shown):]; len(rest) > 0 {
+		more := &FileInfo{
+			Name:    fmt.Sprintf("... and %d more", len(rest)),
+			Path:    node.Path,
+			OutPath: node.OutPath,
+			Omitted: len(rest),
+		}
+		for _, child := range rest {
+			more.Size += child.Size
+			more.DiskSize += child.DiskSize
+		}
+		limited.Children = append(limited.Children, more)
+	}
+	return &limited
+}
+
+// pruneSmallEntries hides entries smaller than limit below node. A
+// directory stays as long as its total meets the limit, even when none
+// of its children do. Totals are left unchanged.
+func pruneSmallEntries(node *FileInfo, limit int64) {
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if child.Size < limit {
+			continue
+		}
+		if child.IsDir {
+			pruneSmallEntries(child, limit)
+		}
+		kept = append(kept, child)
+	}
+	node.Children = kept
+}
+
+// pruneByType hides the entries below node that -type leaves out: with
+// dirsOnly everything but directories, otherwise directories that hold
+// no files. Totals are left unchanged.
+func pruneByType(node *FileInfo, dirsOnly bool) {
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if dirsOnly && !child.IsDir {
+			continue
+		}
+		if child.IsDir {
+			pruneByType(child, dirsOnly)
+			if !dirsOnly && child.Count == 0 {
+				continue
+			}
+		}
+		kept = append(kept, child)
+	}
+	node.Children = kept
+}
+
+// pruneEmptyDirs removes the directories below node that no longer show
+// any file, bottom-up, and reports whether node still shows one. Summarized
+// directories and those at the -depth limit list no contents anyway, so
+// they count as showing their files.
+func pruneEmptyDirs(node *FileInfo, depth, maxDepth int) bool {
+	if node.Summarized || depth == maxDepth {
+		return node.Count > 0
+	}
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if child.IsDir && !pruneEmptyDirs(child, depth+1, maxDepth) {
+			continue
+		}
+		kept = append(kept, child)
+	}
+	node.Children = kept
+	return len(kept) > 0
+}
+
+// parseSize parses a human-readable size such as 500KB, 1.5GB or 1024
+// into bytes. Units are binary (1 KB = 1024 bytes) to match formatSize.
+func parseSize(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if n := len(str); n > 1 && str[n-1] == 'I' && strings.IndexByte("KMGT", str[n-2]) >= 0 {
+		str = str[:n-1] // Accept KiB, MiB, ...
+	}
+
+	multiplier := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	bytes := value * float64(multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("size '%s' is too large", s)
+	}
+	return int64(bytes), nil
+}
+
+// parseAge parses an age such as 30d, 2w or 12h. On top of the units of
+// time.ParseDuration it accepts d for days and w for weeks.
+func parseAge(s string) (time.Duration, error) {
+	str := strings.TrimSpace(s)
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(str, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(str, "w"):
+		unit = 7 * 24 * time.Hour
 	}
 
-	flag.Parse()
+	var age time.Duration
+	if unit > 0 {
+		value, err := strconv.ParseFloat(str[:len(str)-1], 64)
+		if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+			return 0, fmt.Errorf("invalid age '%s'", s)
+		}
+		age = time.Duration(value * float64(unit))
+	} else {
+		var err error
+		if age, err = time.ParseDuration(str); err != nil {
+			return 0, fmt.Errorf("invalid age '%s'", s)
+		}
+	}
+	if age <= 0 {
+		return 0, fmt.Errorf("invalid age '%s', must be positive", s)
+	}
+	return age, nil
+}
 
-	// Get target directory
-	targetDir := "."
-	if flag.NArg() > 0 {
-		targetDir = flag.Arg(0)
+// jsonTimeLayout is a fixed-width RFC 3339 layout, so timestamps in the
+// JSON compare chronologically as plain strings
+const jsonTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// ANSI escape codes used by the colored tree output
+const (
+	ansiReset    = "\x1b[0m"
+	ansiBoldBlue = "\x1b[1;34m"
+	ansiRed      = "\x1b[31m"
+	ansiGray     = "\x1b[90m"
+)
+
+// printColorLegend explains the colors of the text tree in one line
+func printColorLegend(w io.Writer, largeSize int64, f SizeFormat) {
+	fmt.Fprintf(w, "Legend: %sdirectory/%s  %sfile of %s or more%s  %s(size)%s\n",
+		ansiBoldBlue, ansiReset, ansiRed, formatSize(largeSize, f), ansiReset, ansiGray, ansiReset)
+}
+
+// useColor resolves the -color mode. auto enables colors only when w is
+// a terminal, so piped output and files stay plain.
+func useColor(mode string, w io.Writer) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
 	}
+	return isTerminal(w)
+}
 
-	// Check if directory exists
-	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: Directory '%s' does not exist\n", targetDir)
-		os.Exit(1)
+// isTerminal reports whether w is a terminal rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
 	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Parse sort type
-	var sortType SortType
-	switch strings.ToLower(*sortBy) {
-	case "size":
-		sortType = SortBySize
-	case "name":
-		sortType = SortByName
-	default:
-		fmt.Fprintf(os.Stderr, "Error: Invalid sort method '%s'. Use 'name' or 'size'\n", *sortBy)
-		os.Exit(1)
+// sizeBar draws size as a share of total in the bar characters of
+// style, e.g. ████░░░░░░ for 40%
+func sizeBar(size, total int64, width int, style treeStyle) string {
+	filled := 0
+	if total > 0 {
+		filled = int(math.Round(float64(size) / float64(total) * float64(width)))
 	}
+	filled = min(max(filled, 0), width)
+	return strings.Repeat(style.barFull, filled) + strings.Repeat(style.barEmpty, width-filled)
+}
 
-	// Build file tree
-	root, err := buildFileTree(targetDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error building file tree: %v\n", err)
-		os.Exit(1)
+// percentOfParent returns node's size as a percentage of parent's. The
+// root (nil parent) is 100%, children of an empty directory are 0%.
+func percentOfParent(node, parent *FileInfo) float64 {
+	if parent == nil {
+		return 100
+	}
+	total := parent.Size
+	if parent.IsArchive {
+		total = parent.ArchiveSize // Its entries are sized uncompressed
+	}
+	if total <= 0 {
+		return 0
+	}
+	return float64(node.Size) / float64(total) * 100
+}
+
+// convertToJSON converts FileInfo to JSONFileInfo
+func convertToJSON(node *FileInfo, f SizeFormat) *JSONFileInfo {
+	if node == nil {
+		return nil
 	}
 
-	// Sort the tree
-	sortFileTree(root, sortType, *reverse)
+	value, unit := scaleSize(node.Size, f)
+	jsonNode := &JSONFileInfo{
+		Name:            node.Name,
+		Size:            node.Size,
+		DiskSize:        node.DiskSize,
+		ModTime:         node.ModTime.UTC().Format(jsonTimeLayout),
+		FileCount:       node.Count,
+		DirCount:        node.DirCount,
+		SizeStr:         formatSize(node.Size, f),
+		SizeBytes:       node.Size,
+		SizeValue:       roundTo(value, f.Precision),
+		SizeUnit:        unit,
+		IsDir:           node.IsDir,
+		Path:            toSlashPath(node.OutPath),
+		Skipped:         node.Skipped,
+		IsSymlink:       node.IsSymlink,
+		LinkTarget:      node.LinkTarget,
+		Hash:            node.Hash,
+		Summarized:      node.Summarized,
+		HardLink:        node.HardLink,
+		IsMount:         node.IsMount,
+		IsArchive:       node.IsArchive,
+		ArchiveSize:     node.ArchiveSize,
+		InArchive:       node.InArchive,
+		Omitted:         node.Omitted,
+		PercentOfParent: 100, // Replaced below for everything but the root
+	}
+	if node.Omitted == 0 {
+		jsonNode.AgeSeconds = max(int64(time.Since(node.Newest)/time.Second), 0)
+	}
 
-	// Output
-	if *htmlOutput != "" {
-		err := generateHTML(root, targetDir, *htmlOutput)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating HTML: %v\n", err)
-			os.Exit(1)
+	// Convert children
+	if len(node.Children) > 0 && !node.Summarized {
+		jsonNode.Children = make([]*JSONFileInfo, len(node.Children))
+		for i, child := range node.Children {
+			jsonNode.Children[i] = convertToJSON(child, f)
+			jsonNode.Children[i].PercentOfParent = percentOfParent(child, node)
 		}
-		fmt.Printf("HTML output saved to: %s\n", *htmlOutput)
-	} else {
-		printFileTree(root, "", true)
 	}
+
+	return jsonNode
 }
 
-func buildFileTree(rootPath string) (*FileInfo, error) {
-	absPath, err := filepath.Abs(rootPath)
-	if err != nil {
-		return nil, err
+// TextOptions adapts the text files written with -csv and -output to
+// Windows tools, so Excel neither misreads UTF-8 names nor shows the
+// file on a single line
+type TextOptions struct {
+	BOM  bool // Start with a UTF-8 byte order mark
+	CRLF bool // End CSV rows with \r\n instead of \n
+}
+
+// utf8BOM is the UTF-8 encoding of U+FEFF
+const utf8BOM = "\ufeff"
+
+// JSONOptions selects the layout of the JSON trees in the -json, HTML,
+// -dump-data, -save and -treemap output
+type JSONOptions struct {
+	Legacy  bool // The bare trees instead of a JSONDocument
+	Compact bool // On one line, without indentation
+}
+
+// marshal encodes v indented, or on one line with Compact
+func (o JSONOptions) marshal(v any) ([]byte, error) {
+	if o.Compact {
+		return json.Marshal(v)
 	}
+	return json.MarshalIndent(v, "", "  ")
+}
 
-	root := &FileInfo{
-		Name: filepath.Base(absPath),
-		Path: absPath,
+// marshalTreeData returns the JSON embedded as treeData in the HTML
+// output, in the layout of marshalRoots
+func marshalTreeData(roots []*FileInfo, f SizeFormat, opts JSONOptions) ([]byte, error) {
+	jsonRoots := make([]*JSONFileInfo, len(roots))
+	for i, root := range roots {
+		jsonRoots[i] = convertToJSON(root, f)
 	}
+	return marshalRoots(jsonRoots, opts)
+}
 
-	err = buildFileTreeRecursive(root)
-	if err != nil {
-		return nil, err
+// marshalRoots marshals the roots as a JSONDocument. With Legacy, a
+// single root is marshaled as a bare object and several as an array.
+func marshalRoots(jsonRoots []*JSONFileInfo, opts JSONOptions) ([]byte, error) {
+	if opts.Legacy {
+		if len(jsonRoots) == 1 {
+			return opts.marshal(jsonRoots[0])
+		}
+		return opts.marshal(jsonRoots)
 	}
 
-	return root, nil
+	doc := JSONDocument{
+		Version:     jsonVersion,
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Args:        os.Args[1:],
+	}
+	if len(jsonRoots) == 1 {
+		doc.Root = jsonRoots[0]
+	} else {
+		doc.Roots = jsonRoots
+	}
+	return opts.marshal(doc)
 }
 
-func buildFileTreeRecursive(node *FileInfo) error {
-	info, err := os.Stat(node.Path)
+// writeTreeData writes exactly the JSON that generateHTML embeds, so a
+// custom frontend can consume the same data without parsing HTML
+func writeTreeData(roots []*FileInfo, outputFile string, f SizeFormat, opts JSONOptions) error {
+	jsonBytes, err := marshalTreeData(roots, f, opts)
 	if err != nil {
 		return err
 	}
+	return os.WriteFile(outputFile, jsonBytes, 0644)
+}
 
-	node.IsDir = info.IsDir()
+// markdownEscaper escapes characters that Markdown would otherwise
+// treat as formatting in file names
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+)
 
+// appendMarkdown renders node and its children as a nested Markdown list,
+// indented two spaces per level, with directories in bold
+func appendMarkdown(b *strings.Builder, node *FileInfo, depth int, f SizeFormat) {
+	name := markdownEscaper.Replace(node.Name)
 	if node.IsDir {
-		entries, err := os.ReadDir(node.Path)
-		if err != nil {
-			return err
-		}
+		name = "**" + name + "/**"
+	}
+	if node.LinkTarget != "" {
+		name += " -> " + markdownEscaper.Replace(node.LinkTarget)
+	}
+	fmt.Fprintf(b, "%s- %s (%s)\n", strings.Repeat("  ", depth), name, formatSize(node.Size, f))
 
-		var totalSize int64
-		for _, entry := range entries {
-			childPath := filepath.Join(node.Path, entry.Name())
-			child := &FileInfo{
-				Name: entry.Name(),
-				Path: childPath,
-			}
+	if node.Summarized {
+		return
+	}
+	for _, child := range node.Children {
+		appendMarkdown(b, child, depth+1, f)
+	}
+}
 
-			err := buildFileTreeRecursive(child)
-			if err != nil {
-				continue // Skip files we can't read
-			}
+// writeMarkdown writes the trees as Markdown lists to w
+func writeMarkdown(w io.Writer, roots []*FileInfo, f SizeFormat) error {
+	var b strings.Builder
+	for _, root := range roots {
+		appendMarkdown(&b, root, 0, f)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
 
-			node.Children = append(node.Children, child)
-			totalSize += child.Size
+// writeJSON writes the tree as indented JSON to w, in the layout of
+// marshalRoots. With byExt, each root also carries its per-extension
+// breakdown.
+func writeJSON(w io.Writer, roots []*FileInfo, f SizeFormat, byExt bool, opts JSONOptions) error {
+	jsonRoots := make([]*JSONFileInfo, len(roots))
+	for i, root := range roots {
+		jsonRoots[i] = convertToJSON(root, f)
+		if byExt {
+			jsonRoots[i].ByExtension = extensionStats([]*FileInfo{root}, f)
 		}
-		node.Size = totalSize
-	} else {
-		node.Size = info.Size()
 	}
 
-	return nil
-}
-
-func sortFileTree(root *FileInfo, sortType SortType, reverse bool) {
-	if root == nil || len(root.Children) == 0 {
-		return
+	jsonBytes, err := marshalRoots(jsonRoots, opts)
+	if err != nil {
+		return err
 	}
+	_, err = w.Write(append(jsonBytes, '\n'))
+	return err
+}
 
-	// Recursively sort child directories
-	for _, child := range root.Children {
-		if child.IsDir {
-			sortFileTree(child, sortType, reverse)
+// writeNDJSON writes one JSON object per file and directory to w, one
+// per line in tree order, encoding each entry as it is reached instead of
+// building the whole document first
+func writeNDJSON(w io.Writer, roots []*FileInfo, f SizeFormat) error {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	for _, root := range roots {
+		if err := writeNDJSONEntries(enc, root, 0, f); err != nil {
+			return err
 		}
 	}
+	return buf.Flush()
+}
 
-	// Sort current level
-	sort.Slice(root.Children, func(i, j int) bool {
-		a, b := root.Children[i], root.Children[j]
+// writeNDJSONEntries encodes node and its descendants in pre-order
+func writeNDJSONEntries(enc *json.Encoder, node *FileInfo, depth int, f SizeFormat) error {
+	err := enc.Encode(NDJSONEntry{
+		Path:    toSlashPath(node.OutPath),
+		Name:    node.Name,
+		Size:    node.Size,
+		SizeStr: formatSize(node.Size, f),
+		IsDir:   node.IsDir,
+		Depth:   depth,
+	})
+	if err != nil {
+		return err
+	}
 
-		var result bool
-		switch sortType {
-		case SortBySize:
-			// For size sorting, don't prioritize folders
-			result = a.Size > b.Size // Size descending
-		default: // SortByName
-			// For name sorting, folders first
-			if a.IsDir != b.IsDir {
-				return a.IsDir
-			}
-			result = strings.ToLower(a.Name) < strings.ToLower(b.Name) // Name ascending
+	for _, child := range node.Children {
+		if err := writeNDJSONEntries(enc, child, depth+1, f); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if reverse {
-			return !result
-		}
-		return result
-	})
+// printScanStats prints how long the scans of roots took and how many
+// files and bytes they counted per second
+func printScanStats(w io.Writer, roots []*FileInfo, elapsed time.Duration, f SizeFormat) {
+	var files int
+	var size int64
+	for _, root := range roots {
+		files += root.Count
+		size += root.Size
+	}
+	seconds := max(elapsed.Seconds(), 1e-9)
+	precision := time.Millisecond
+	if elapsed < time.Second {
+		precision = time.Microsecond // Small trees scan in well under a millisecond
+	}
+	fmt.Fprintf(w, "Scanned %s (%s) in %s: %.0f files/s, %s/s\n", pluralize(files, "file"), formatSize(size, f),
+		elapsed.Round(precision), float64(files)/seconds, formatSize(int64(float64(size)/seconds), f))
 }
 
-func printFileTree(node *FileInfo, prefix string, isLast bool) {
-	if node == nil {
-		return
+// walkRows calls row for node and its descendants in pre-order, so
+// every directory comes before its contents, stopping at the first error
+func walkRows(node *FileInfo, depth int, row func(node *FileInfo, depth int) error) error {
+	if err := row(node, depth); err != nil {
+		return err
 	}
 
-	// Print current node
-	var connector string
-	if prefix == "" {
-		connector = ""
-	} else if isLast {
-		connector = "└── "
-	} else {
-		connector = "├── "
+	for _, child := range node.Children {
+		if err := walkRows(child, depth+1, row); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	sizeStr := formatSize(node.Size)
-	if node.IsDir {
-		fmt.Printf("%s%s%s/ (%s)\n", prefix, connector, node.Name, sizeStr)
-	} else {
-		fmt.Printf("%s%s%s (%s)\n", prefix, connector, node.Name, sizeStr)
+// writeCSV writes one row per file and directory with a header row.
+// Directories report their aggregate size, like the tree view.
+func writeCSV(roots []*FileInfo, outputFile string, f SizeFormat, text TextOptions) error {
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	// Print child nodes
-	if len(node.Children) > 0 {
-		var newPrefix string
-		if prefix == "" {
-			if isLast {
-				newPrefix = "    "
-			} else {
-				newPrefix = "│   "
-			}
-		} else if isLast {
-			newPrefix = prefix + "    "
-		} else {
-			newPrefix = prefix + "│   "
+	if text.BOM {
+		if _, err := io.WriteString(file, utf8BOM); err != nil {
+			return err
 		}
+	}
+	if err := writeCSVTo(file, roots, f, text.CRLF); err != nil {
+		return err
+	}
+	return file.Close()
+}
 
-		for i, child := range node.Children {
-			isChildLast := i == len(node.Children)-1
-			printFileTree(child, newPrefix, isChildLast)
+// writeCSVTo writes the CSV rows of writeCSV to out, ending them with
+// \r\n if crlf is set
+func writeCSVTo(out io.Writer, roots []*FileInfo, f SizeFormat, crlf bool) error {
+	w := csv.NewWriter(out)
+	w.UseCRLF = crlf
+	w.Write([]string{"path", "name", "size", "sizeStr", "isDir", "depth"})
+	for _, root := range roots {
+		err := walkRows(root, 0, func(node *FileInfo, depth int) error {
+			return w.Write([]string{
+				toSlashPath(node.OutPath),
+				node.Name,
+				strconv.FormatInt(node.Size, 10),
+				formatSize(node.Size, f),
+				strconv.FormatBool(node.IsDir),
+				strconv.Itoa(depth),
+			})
+		})
+		if err != nil {
+			return err
 		}
 	}
+	w.Flush()
+	return w.Error()
 }
 
-func formatSize(size int64) string {
-	const (
-		B  = 1
-		KB = 1024 * B
-		MB = 1024 * KB
-		GB = 1024 * MB
-		TB = 1024 * GB
-	)
+// writeTSV writes one path<TAB>bytes<TAB>isDir line per file and
+// directory to out, in the order of the CSV rows and without a header,
+// for cut and awk. Tabs and newlines in paths are escaped like in
+// -machine-tree.
+func writeTSV(out io.Writer, roots []*FileInfo) error {
+	w := bufio.NewWriter(out)
+	for _, root := range roots {
+		err := walkRows(root, 0, func(node *FileInfo, depth int) error {
+			_, err := fmt.Fprintf(w, "%s\t%d\t%t\n", machineNameEscaper.Replace(toSlashPath(node.OutPath)), node.Size, node.IsDir)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
 
-	switch {
-	case size >= TB:
-		return fmt.Sprintf("%.2f TB", float64(size)/TB)
-	case size >= GB:
-		return fmt.Sprintf("%.2f GB", float64(size)/GB)
-	case size >= MB:
-		return fmt.Sprintf("%.2f MB", float64(size)/MB)
-	case size >= KB:
-		return fmt.Sprintf("%.2f KB", float64(size)/KB)
-	default:
-		return fmt.Sprintf("%d B", size)
+// relativePath returns path relative to rootPath with forward slashes,
+// falling back to the path itself if it isn't below rootPath
+func relativePath(rootPath, path string) string {
+	relPath, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return path
 	}
+	return filepath.ToSlash(relPath)
 }
 
-// convertToJSON converts FileInfo to JSONFileInfo
-func convertToJSON(node *FileInfo) *JSONFileInfo {
-	if node == nil {
-		return nil
+// toSlashPath returns path with forward slashes, as the JSON, CSV and
+// TSV outputs write paths so they read the same on every platform. The
+// native form stays in FileInfo.Path for accessing the files.
+func toSlashPath(path string) string {
+	return filepath.ToSlash(path)
+}
+
+// collectSizes adds node and its descendants to sizes, keyed by their
+// slash-separated path relative to rootPath
+func collectSizes(node *FileInfo, rootPath string, includeDirs bool, sizes map[string]int64) {
+	if !node.IsDir || includeDirs {
+		sizes[relativePath(rootPath, node.Path)] = node.Size
 	}
 
-	jsonNode := &JSONFileInfo{
-		Name:    node.Name,
-		Size:    node.Size,
-		SizeStr: formatSize(node.Size),
-		IsDir:   node.IsDir,
-		Path:    node.Path,
+	for _, child := range node.Children {
+		collectSizes(child, rootPath, includeDirs, sizes)
 	}
+}
 
-	// Convert children
-	if len(node.Children) > 0 {
-		jsonNode.Children = make([]*JSONFileInfo, len(node.Children))
-		for i, child := range node.Children {
-			jsonNode.Children[i] = convertToJSON(child)
+// writeSizeMap writes a flat JSON object mapping each relative path to
+// its size in bytes, for consumers that want to look sizes up by path
+func writeSizeMap(roots []*FileInfo, outputFile string, includeDirs bool) error {
+	sizes := make(map[string]int64)
+	for _, root := range roots {
+		rootPath := root.Path
+		if len(roots) > 1 || !root.IsDir {
+			// Keep paths from different trees apart by their directory
+			// name, and key a lone file by its name
+			rootPath = filepath.Dir(root.Path)
 		}
+		collectSizes(root, rootPath, includeDirs, sizes)
 	}
 
-	return jsonNode
-}
-
-func generateHTML(root *FileInfo, targetDir, outputFile string) error {
-	file, err := os.Create(outputFile)
+	jsonBytes, err := json.MarshalIndent(sizes, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	return os.WriteFile(outputFile, jsonBytes, 0644)
+}
 
+func generateHTML(w io.Writer, roots []*FileInfo, targetDir string, opts HTMLOptions) error {
 	// Convert to JSON
-	jsonData := convertToJSON(root)
-	jsonBytes, err := json.MarshalIndent(jsonData, "", "  ")
+	jsonBytes, err := marshalTreeData(roots, opts.Format, opts.JSON)
 	if err != nil {
 		return err
 	}
 
+	sortOrder := "asc"
+	if opts.Reverse {
+		sortOrder = "desc"
+	}
+
 	// Write complete HTML with embedded JSON
-	fmt.Fprintf(file, `<!DOCTYPE html>
+	_, err = fmt.Fprintf(w, `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
@@ -315,18 +3235,51 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
     <title>File Size Tree - %s</title>
     <style>
         body {
+            --bg: #f5f5f5;
+            --panel: white;
+            --text: #333;
+            --hover: #f0f0f0;
+            --folder: #0066cc;
+            --muted: #666;
+            --connector: #999;
+            --controls-bg: #f8f9fa;
+            --controls-border: #e9ecef;
+            --label: #495057;
+            --input-bg: white;
+            --input-border: #ced4da;
+            --button: #007bff;
+            --button-hover: #0056b3;
+            --shadow: rgba(0,0,0,0.1);
             font-family: 'Courier New', monospace;
             margin: 20px;
-            background-color: #f5f5f5;
+            background-color: var(--bg);
+            color: var(--text);
+        }
+        body[data-theme="dark"] {
+            --bg: #1e1e1e;
+            --panel: #252526;
+            --text: #d4d4d4;
+            --hover: #2a2d2e;
+            --folder: #4fa3ff;
+            --muted: #a0a0a0;
+            --connector: #6a6a6a;
+            --controls-bg: #2d2d30;
+            --controls-border: #3e3e42;
+            --label: #c8c8c8;
+            --input-bg: #3c3c3c;
+            --input-border: #555;
+            --button: #0e639c;
+            --button-hover: #1177bb;
+            --shadow: rgba(0,0,0,0.5);
         }
         .container {
-            background-color: white;
+            background-color: var(--panel);
             padding: 20px;
             border-radius: 8px;
-            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
+            box-shadow: 0 2px 10px var(--shadow);
         }
         h1 {
-            color: #333;
+            color: var(--text);
             margin-bottom: 20px;
         }
         .tree {
@@ -340,17 +3293,20 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             padding: 2px 0;
         }
         .tree-item:hover {
-            background-color: #f0f0f0;
+            background-color: var(--hover);
+        }
+        .no-bars .tree-item {
+            background-image: none !important;
         }
         .folder {
-            color: #0066cc;
+            color: var(--folder);
             font-weight: bold;
         }
         .file {
-            color: #333;
+            color: var(--text);
         }
         .size {
-            color: #666;
+            color: var(--muted);
             font-weight: normal;
         }
         .toggle {
@@ -367,14 +3323,14 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             display: none;
         }
         .connector {
-            color: #999;
+            color: var(--connector);
         }
         .controls {
             margin-bottom: 20px;
             padding: 15px;
-            background-color: #f8f9fa;
+            background-color: var(--controls-bg);
             border-radius: 5px;
-            border: 1px solid #e9ecef;
+            border: 1px solid var(--controls-border);
         }
         .control-group {
             display: inline-block;
@@ -383,27 +3339,28 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
         .control-group label {
             font-weight: bold;
             margin-right: 8px;
-            color: #495057;
+            color: var(--label);
         }
-        .control-group select, .control-group button {
+        .control-group select, .control-group button, .control-group input {
             padding: 5px 10px;
-            border: 1px solid #ced4da;
+            border: 1px solid var(--input-border);
             border-radius: 3px;
-            background-color: white;
+            background-color: var(--input-bg);
+            color: var(--text);
             font-family: inherit;
         }
         .control-group button {
-            background-color: #007bff;
+            background-color: var(--button);
             color: white;
             cursor: pointer;
             margin-left: 10px;
         }
         .control-group button:hover {
-            background-color: #0056b3;
+            background-color: var(--button-hover);
         }
     </style>
 </head>
-<body>
+<body data-default-theme="%s">
     <div class="container">
         <h1>File Size Tree: %s</h1>
         <div class="controls">
@@ -411,7 +3368,11 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
                 <label for="sortBy">Sort by:</label>
                 <select id="sortBy">
                     <option value="name">Name</option>
+                    <option value="natural">Natural</option>
                     <option value="size">Size</option>
+                    <option value="mtime">Modified</option>
+                    <option value="count">File count</option>
+                    <option value="ext">Extension</option>
                 </select>
             </div>
             <div class="control-group">
@@ -425,20 +3386,76 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
                 <button onclick="applySorting()">Apply Sort</button>
                 <button onclick="expandAll()">Expand All</button>
                 <button onclick="collapseAll()">Collapse All</button>
+                <button id="barsToggle" onclick="toggleBars()">Hide Bars</button>
+            </div>
+            <div class="control-group">
+                <label for="search">Filter:</label>
+                <input type="text" id="search" placeholder="Name contains..." oninput="applyFilter()">
+                <button onclick="clearFilter()">Clear</button>
+            </div>
+            <div class="control-group">
+                <button id="themeToggle" onclick="toggleTheme()">Dark Mode</button>
             </div>
         </div>
-        <div class="tree" id="fileTree">
+        <div class="tree" id="fileTree" data-collapse-over="%d" data-collapse-below="%d">
         </div>
     </div>
     <script>
         // Embedded JSON data
-        const treeData = %s;
+        const treeDocument = %s;
+        // A versioned document wraps the trees, unless written with -legacy-json
+        const treeData = treeDocument.version ? (treeDocument.root || treeDocument.roots) : treeDocument;
+        
+        function sizeLabel(data) {
+            let label = data.sizeStr;
+            if (data.isDir) {
+                label += ', ' + data.fileCount + (data.fileCount === 1 ? ' file' : ' files');
+            }
+            if (data.summarized) {
+                label += ', summarized';
+            }
+            if (data.skipped) {
+                label += ', partial: ' + data.skipped + ' skipped';
+            }
+            return label;
+        }
+        
+        function displayName(data) {
+            let name = data.name + (data.isDir ? '/' : '');
+            if (data.linkTarget) {
+                name += ' -> ' + data.linkTarget;
+            }
+            return name;
+        }
+        
+        // Share of the parent's size in percent, like percentOfParent in
+        // the Go code: 100 for a root (null parentSize), 0 in an empty folder
+        function percentOf(size, parentSize) {
+            if (parentSize === null) return 100;
+            return parentSize > 0 ? size / parentSize * 100 : 0;
+        }
+        
+        // The size data's children are a share of: an archive's entries
+        // are sized uncompressed, so they count against archiveSize
+        function childrenTotal(data) {
+            return data.isArchive ? (data.archiveSize || 0) : data.size;
+        }
+        
+        // Background bar as wide as the percentage, from green to red
+        function sizeBar(percent) {
+            const hue = Math.round(120 - percent * 1.2);
+            const color = 'hsla(' + hue + ', 70%%, 50%%, 0.25)';
+            const width = percent.toFixed(1) + '%%';
+            return 'linear-gradient(to right, ' + color + ' ' + width + ', transparent ' + width + ')';
+        }
         
-        function renderTree(data, container, prefix = '', isLast = true) {
+        function renderTree(data, container, prefix = '', isLast = true, parentSize = null) {
             if (!data) return;
             
             const item = document.createElement('div');
             item.className = 'tree-item ' + (data.isDir ? 'folder' : 'file');
+            const percent = percentOf(data.size, parentSize);
+            item.style.backgroundImage = sizeBar(percent);
             
             let connector = '';
             if (prefix) {
@@ -447,12 +3464,12 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             
             let content = '';
             if (data.isDir && data.children && data.children.length > 0) {
-                content = '<span class="connector">' + prefix + connector + '</span><span class="toggle">▼</span>' + data.name + '/ <span class="size">(' + data.sizeStr + ')</span>';
+                content = '<span class="connector">' + prefix + connector + '</span><span class="toggle">▼</span>' + displayName(data) + ' <span class="size">(' + sizeLabel(data) + ')</span>';
                 item.onclick = function() { toggleFolder(this); };
             } else if (data.isDir) {
-                content = '<span class="connector">' + prefix + connector + '</span>' + data.name + '/ <span class="size">(' + data.sizeStr + ')</span>';
+                content = '<span class="connector">' + prefix + connector + '</span>' + displayName(data) + ' <span class="size">(' + sizeLabel(data) + ')</span>';
             } else {
-                content = '<span class="connector">' + prefix + connector + '</span>' + data.name + ' <span class="size">(' + data.sizeStr + ')</span>';
+                content = '<span class="connector">' + prefix + connector + '</span>' + displayName(data) + ' <span class="size">(' + sizeLabel(data) + ')</span>';
             }
             
             item.innerHTML = content;
@@ -460,6 +3477,7 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             item.dataset.size = data.size;
             item.dataset.sizeStr = data.sizeStr;
             item.dataset.isDir = data.isDir;
+            item.dataset.percent = percent;
             
             container.appendChild(item);
             
@@ -467,10 +3485,21 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
                 const childrenContainer = document.createElement('div');
                 childrenContainer.className = 'children';
                 
+                // Start wide and small folders collapsed to keep the initial
+                // view manageable. The scanned directories stay open.
+                const collapseOver = parseInt(document.getElementById('fileTree').dataset.collapseOver, 10);
+                const collapseBelow = parseInt(document.getElementById('fileTree').dataset.collapseBelow, 10);
+                if (collapseOver > 0 && data.children.length > collapseOver ||
+                    collapseBelow > 0 && parentSize !== null && data.size < collapseBelow) {
+                    childrenContainer.classList.add('hidden');
+                    const toggle = item.querySelector('.toggle');
+                    if (toggle) toggle.textContent = '▶';
+                }
+                
                 const newPrefix = prefix + (isLast ? '    ' : '│   ');
                 for (let i = 0; i < data.children.length; i++) {
                     const isChildLast = i === data.children.length - 1;
-                    renderTree(data.children[i], childrenContainer, newPrefix, isChildLast);
+                    renderTree(data.children[i], childrenContainer, newPrefix, isChildLast, childrenTotal(data));
                 }
                 
                 container.appendChild(childrenContainer);
@@ -492,6 +3521,88 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             }
         }
         
+        // Compare strings by code point, matching Go's byte-wise comparison
+        function compareText(a, b) {
+            const ca = Array.from(a);
+            const cb = Array.from(b);
+            const n = Math.min(ca.length, cb.length);
+            for (let i = 0; i < n; i++) {
+                const d = ca[i].codePointAt(0) - cb[i].codePointAt(0);
+                if (d !== 0) return d < 0 ? -1 : 1;
+            }
+            return Math.sign(ca.length - cb.length);
+        }
+        
+        function isDigit(c) {
+            return c >= '0' && c <= '9';
+        }
+        
+        // Mirrors naturalCompare in the Go code
+        function compareNatural(a, b) {
+            const ca = Array.from(a);
+            const cb = Array.from(b);
+            let i = 0, j = 0;
+            while (i < ca.length && j < cb.length) {
+                if (isDigit(ca[i]) && isDigit(cb[j])) {
+                    let ei = i, ej = j;
+                    while (ei < ca.length && isDigit(ca[ei])) ei++;
+                    while (ej < cb.length && isDigit(cb[ej])) ej++;
+                    const da = ca.slice(i, ei).join('').replace(/^0+/, '');
+                    const db = cb.slice(j, ej).join('').replace(/^0+/, '');
+                    if (da.length !== db.length) return da.length < db.length ? -1 : 1;
+                    if (da !== db) return da < db ? -1 : 1;
+                    i = ei;
+                    j = ej;
+                    continue;
+                }
+                const d = ca[i].codePointAt(0) - cb[j].codePointAt(0);
+                if (d !== 0) return d < 0 ? -1 : 1;
+                i++;
+                j++;
+            }
+            return Math.sign((ca.length - i) - (cb.length - j));
+        }
+        
+        // Mirrors fileExt in the Go code: lowercase with the leading dot,
+        // and dotfiles such as .bashrc have none
+        function fileExt(name) {
+            const base = name.startsWith('.') ? name.slice(1) : name;
+            const dot = base.lastIndexOf('.');
+            return dot < 0 ? '' : base.slice(dot).toLowerCase();
+        }
+        
+        // Mirrors compareFileInfo in the Go code, keep the two in sync
+        function compareNodes(a, b, sortBy, ascending) {
+            // The "... and N more" entry of -max-children always stays last
+            if (!a.omitted !== !b.omitted) return a.omitted ? 1 : -1;
+            
+            let result = 0;
+            if (sortBy === 'size') {
+                result = Math.sign(b.size - a.size); // Default descending for size
+            } else if (sortBy === 'mtime') {
+                result = compareText(b.modTime, a.modTime); // Newest first
+            } else if (sortBy === 'count') {
+                // Most files first, a file counting as one
+                result = Math.sign((b.isDir ? b.fileCount : 1) - (a.isDir ? a.fileCount : 1));
+            } else if (a.isDir !== b.isDir) {
+                // For name sorting, folders first regardless of order
+                return a.isDir ? -1 : 1;
+            } else if (sortBy === 'natural') {
+                result = compareNatural(a.name.toLowerCase(), b.name.toLowerCase());
+            } else if (sortBy === 'ext' && !a.isDir) {
+                result = compareText(fileExt(a.name), fileExt(b.name)); // No extension first
+            }
+            
+            if (result === 0) {
+                result = compareText(a.name.toLowerCase(), b.name.toLowerCase());
+            }
+            if (result === 0) {
+                result = compareText(a.path, b.path);
+            }
+            
+            return ascending ? result : -result;
+        }
+        
         function sortTreeData(data, sortBy, ascending) {
             if (!data || !data.children) return data;
             
@@ -505,20 +3616,7 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
                 node.children.forEach(sortRecursive);
                 
                 // Sort current level
-                node.children.sort((a, b) => {
-                    let result;
-                    if (sortBy === 'size') {
-                        result = b.size - a.size; // Default descending for size
-                    } else {
-                        // For name sorting, folders first
-                        if (a.isDir !== b.isDir) {
-                            return a.isDir ? -1 : 1;
-                        }
-                        result = a.name.toLowerCase().localeCompare(b.name.toLowerCase());
-                    }
-                    
-                    return ascending ? result : -result;
-                });
+                node.children.sort((a, b) => compareNodes(a, b, sortBy, ascending));
             }
             
             sortRecursive(sortedData);
@@ -530,17 +3628,75 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             const sortOrder = document.getElementById('sortOrder').value;
             const ascending = sortOrder === 'asc';
             
-            const sortedData = sortTreeData(treeData, sortBy, ascending);
-            
             const container = document.getElementById('fileTree');
             container.innerHTML = '';
             
-            if (sortedData.children) {
-                sortedData.children.forEach((child, index) => {
-                    const isLast = index === sortedData.children.length - 1;
-                    renderTree(child, container, '', isLast);
+            // Several scanned directories are embedded as an array of roots
+            if (Array.isArray(treeData)) {
+                treeData.forEach((root, index) => {
+                    const isLast = index === treeData.length - 1;
+                    renderTree(sortTreeData(root, sortBy, ascending), container, '', isLast);
                 });
+            } else {
+                const sortedData = sortTreeData(treeData, sortBy, ascending);
+                if (sortedData.children) {
+                    sortedData.children.forEach((child, index) => {
+                        const isLast = index === sortedData.children.length - 1;
+                        renderTree(child, container, '', isLast, childrenTotal(sortedData));
+                    });
+                } else if (!sortedData.isDir) {
+                    // A single file was scanned, show just that
+                    renderTree(sortedData, container);
+                }
+            }
+            
+            // Keep the current filter after re-rendering
+            applyFilter();
+        }
+        
+        // Shows the items of container whose name contains query, along
+        // with their ancestors, expanding folders on the way. Everything
+        // below a matching folder stays visible. Returns whether anything
+        // in container is shown.
+        function filterItems(container, query, showAll) {
+            let anyShown = false;
+            for (const item of container.children) {
+                if (!item.classList.contains('tree-item')) continue;
+                
+                const children = item.nextElementSibling;
+                const hasChildren = children && children.classList.contains('children');
+                const matched = showAll || item.dataset.name.toLowerCase().includes(query);
+                const childShown = hasChildren && filterItems(children, query, matched);
+                const shown = matched || childShown;
+                
+                item.style.display = shown ? '' : 'none';
+                if (hasChildren) {
+                    children.style.display = shown ? '' : 'none';
+                    if (childShown && query && !showAll) {
+                        children.classList.remove('hidden');
+                        const toggle = item.querySelector('.toggle');
+                        if (toggle) toggle.textContent = '▼';
+                    }
+                }
+                anyShown = anyShown || shown;
             }
+            return anyShown;
+        }
+        
+        function applyFilter() {
+            const query = document.getElementById('search').value.trim().toLowerCase();
+            filterItems(document.getElementById('fileTree'), query, query === '');
+        }
+        
+        function clearFilter() {
+            document.getElementById('search').value = '';
+            applyFilter();
+        }
+        
+        function toggleBars() {
+            const tree = document.getElementById('fileTree');
+            const hidden = tree.classList.toggle('no-bars');
+            document.getElementById('barsToggle').textContent = hidden ? 'Show Bars' : 'Hide Bars';
         }
         
         function expandAll() {
@@ -561,13 +3717,51 @@ func generateHTML(root *FileInfo, targetDir, outputFile string) error {
             });
         }
         
-        // Initial render
+        // The theme chosen with the toggle button, remembered across pages
+        const themeKey = 'filesize-theme';
+        
+        function setTheme(theme) {
+            document.body.dataset.theme = theme;
+            document.getElementById('themeToggle').textContent = theme === 'dark' ? 'Light Mode' : 'Dark Mode';
+        }
+        
+        function toggleTheme() {
+            const theme = document.body.dataset.theme === 'dark' ? 'light' : 'dark';
+            localStorage.setItem(themeKey, theme);
+            setTheme(theme);
+        }
+        
+        // A stored choice wins over the -theme default, and auto follows
+        // the system setting until the button is used
+        function initTheme() {
+            const stored = localStorage.getItem(themeKey);
+            if (stored === 'dark' || stored === 'light') {
+                setTheme(stored);
+                return;
+            }
+            const theme = document.body.dataset.defaultTheme;
+            if (theme !== 'auto') {
+                setTheme(theme);
+                return;
+            }
+            const query = window.matchMedia('(prefers-color-scheme: dark)');
+            setTheme(query.matches ? 'dark' : 'light');
+            query.addEventListener('change', function(e) {
+                if (!localStorage.getItem(themeKey)) {
+                    setTheme(e.matches ? 'dark' : 'light');
+                }
+            });
+        }
+        
+        // Initial render, using the same order as the command line
         document.addEventListener('DOMContentLoaded', function() {
+            initTheme();
+            document.getElementById('sortBy').value = '%s';
+            document.getElementById('sortOrder').value = '%s';
             applySorting();
         });
     </script>
 </body>
-</html>`, targetDir, targetDir, string(jsonBytes))
-
-	return nil
+</html>`, targetDir, opts.Theme, targetDir, opts.CollapseOver, opts.CollapseBelow, string(jsonBytes), opts.SortType, sortOrder)
+	return err
 }
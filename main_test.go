@@ -0,0 +1,982 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so
+// runFilesize can check the output and exit status of a whole run
+const runMainEnv = "FILESIZE_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFilesize runs the program with args and stdin, without any config
+// file, and returns what it wrote and its exit status
+func runFilesize(t *testing.T, stdin string, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", "HOME="+t.TempDir(), "USERPROFILE="+t.TempDir())
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status = exitErr.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), status
+}
+
+// writeTree creates the files under dir, keyed by their slash-separated
+// paths, with the given contents, and their parent directories
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scanTree builds the tree of dir with opts, or the defaults of a
+// sequential, unlimited scan if opts is nil
+func scanTree(t *testing.T, dir string, opts *ScanOptions) (*FileInfo, *ScanStats) {
+	t.Helper()
+	if opts == nil {
+		opts = &ScanOptions{MaxDepth: -1, Jobs: 1}
+	}
+	root, stats, err := buildFileTree(context.Background(), dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, stats
+}
+
+// child returns the child of node named name, failing the test if there
+// is none
+func child(t *testing.T, node *FileInfo, name string) *FileInfo {
+	t.Helper()
+	for _, c := range node.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("%s has no child %s, only %v", node.Path, name, childNames(node))
+	return nil
+}
+
+// childNames returns the names of node's children in order
+func childNames(node *FileInfo) []string {
+	names := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		names[i] = child.Name
+	}
+	return names
+}
+
+func TestSortFileTreeResort(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sub := &FileInfo{Name: "sub", IsDir: true, Size: 30, Count: 2, ModTime: base, Children: []*FileInfo{
+		{Name: "b.txt", Size: 10, ModTime: base.Add(2 * time.Hour)},
+		{Name: "a.txt", Size: 20, ModTime: base.Add(time.Hour)},
+	}}
+	root := &FileInfo{Name: "root", IsDir: true, Size: 135, Children: []*FileInfo{
+		{Name: "small", Size: 5, ModTime: base.Add(3 * time.Hour)},
+		sub,
+		{Name: "big", Size: 100, ModTime: base},
+	}}
+
+	// One tree sorted again and again must match a fresh sort each time
+	steps := []struct {
+		sortType SortType
+		reverse  bool
+		want     []string
+		wantSub  []string
+	}{
+		{SortByName, false, []string{"sub", "big", "small"}, []string{"a.txt", "b.txt"}},
+		{SortBySize, false, []string{"big", "sub", "small"}, []string{"a.txt", "b.txt"}},
+		{SortByName, true, []string{"sub", "small", "big"}, []string{"b.txt", "a.txt"}}, // Folders stay first
+		{SortByMtime, false, []string{"small", "big", "sub"}, []string{"b.txt", "a.txt"}},
+		{SortBySize, true, []string{"small", "sub", "big"}, []string{"b.txt", "a.txt"}},
+		{SortByName, false, []string{"sub", "big", "small"}, []string{"a.txt", "b.txt"}},
+	}
+	for _, step := range steps {
+		for range 2 { // Sorting an already sorted tree changes nothing
+			sortFileTree(root, step.sortType, step.reverse)
+			if got := childNames(root); !slices.Equal(got, step.want) {
+				t.Errorf("sort %d reverse %t: got %v, want %v", step.sortType, step.reverse, got, step.want)
+			}
+			if got := childNames(sub); !slices.Equal(got, step.wantSub) {
+				t.Errorf("sort %d reverse %t: sub got %v, want %v", step.sortType, step.reverse, got, step.wantSub)
+			}
+		}
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"sub/file": "12345"})
+	if err := os.Symlink("..", filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	t.Run("not followed", func(t *testing.T) {
+		root, stats := scanTree(t, dir, nil)
+		loop := child(t, child(t, root, "sub"), "loop")
+		if !loop.IsSymlink || loop.IsDir || len(loop.Children) > 0 {
+			t.Errorf("loop should be a leaf symlink, got %+v", loop)
+		}
+		if len(stats.Skipped) != 0 {
+			t.Errorf("nothing should be skipped, got %v", stats.Skipped)
+		}
+	})
+
+	t.Run("followed", func(t *testing.T) {
+		root, stats := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, Follow: true})
+		sub := child(t, root, "sub")
+		if slices.Contains(childNames(sub), "loop") {
+			t.Errorf("the loop should be left out, got %v", childNames(sub))
+		}
+		if root.Size != 5 || root.Count != 1 {
+			t.Errorf("got %d bytes in %d files, want 5 in 1", root.Size, root.Count)
+		}
+		if len(stats.Skipped) != 1 || !errors.Is(stats.Skipped[0].Err, errSymlinkLoop) {
+			t.Errorf("want the loop skipped, got %v", stats.Skipped)
+		}
+	})
+
+	t.Run("hashed", func(t *testing.T) {
+		_, stats := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, Hash: hashAlgorithms["sha256"]})
+		if stats.HashFailed != 0 {
+			t.Errorf("symlinks shouldn't be hashed, %d hashes failed", stats.HashFailed)
+		}
+	})
+}
+
+// BenchmarkBuildFileTree scans a generated tree 4 directories deep and
+// 4 wide, 10 files in each, sequentially and with a worker per CPU, at
+// least 4
+func BenchmarkBuildFileTree(b *testing.B) {
+	dir := b.TempDir()
+	var generate func(path string, depth int)
+	generate = func(path string, depth int) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for i := range 10 {
+			if err := os.WriteFile(filepath.Join(path, fmt.Sprintf("file%d", i)), make([]byte, i*100), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if depth < 4 {
+			for i := range 4 {
+				generate(filepath.Join(path, fmt.Sprintf("dir%d", i)), depth+1)
+			}
+		}
+	}
+	generate(dir, 0)
+
+	for _, jobs := range []int{1, max(runtime.NumCPU(), 4)} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			opts := &ScanOptions{MaxDepth: -1, Jobs: jobs}
+			for range b.N {
+				if _, _, err := buildFileTree(context.Background(), dir, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1024", 1024, false},
+		{"500B", 500, false},
+		{"10KB", 10 << 10, false},
+		{"10k", 10 << 10, false},
+		{"1.5GB", 3 << 29, false},
+		{"2MiB", 2 << 20, false},
+		{"1T", 1 << 40, false},
+		{" 0.5 MB ", 1 << 19, false},
+		{"1.9", 1, false}, // Fractions of a byte are dropped
+		{"", 0, true},
+		{"MB", 0, true},
+		{"abc", 0, true},
+		{"-1KB", 0, true},
+		{"10XB", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"9000000T", 0, true}, // Beyond int64
+		{"9223372036854775807", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExcludeHidden(t *testing.T) {
+	// The target's own name starting with a dot doesn't keep it from being scanned
+	dir := filepath.Join(t.TempDir(), ".project")
+	writeTree(t, dir, map[string]string{
+		".git/HEAD":         "ref: refs/heads/main\n",
+		".git/objects/ab/c": "0123456789",
+		".env":              "SECRET=1\n",
+		".config/app.conf":  "key=value\n",
+		"src/main.go":       "package main\n",
+		"src/.cache":        "cached",
+		"README":            "hello",
+	})
+
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, SkipHidden: true})
+	if got, want := childNames(root), []string{"README", "src"}; !slices.Equal(slices.Sorted(slices.Values(got)), want) {
+		t.Errorf("root children = %v, want %v", got, want)
+	}
+	if got := childNames(child(t, root, "src")); !slices.Equal(got, []string{"main.go"}) {
+		t.Errorf("src children = %v, want [main.go]", got)
+	}
+	// Hidden entries count toward nothing
+	if want := int64(len("package main\n") + len("hello")); root.Size != want || root.Count != 2 || root.DirCount != 1 {
+		t.Errorf("got %d bytes, %d files, %d dirs; want %d bytes, 2 files, 1 dir", root.Size, root.Count, root.DirCount, want)
+	}
+
+	root, _ = scanTree(t, dir, nil)
+	if root.Count != 7 {
+		t.Errorf("without -exclude-hidden got %d files, want 7", root.Count)
+	}
+}
+
+func TestHardLinksCountedOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"z/orig": "0123456789", "m/other": "abc"})
+	if err := os.MkdirAll(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "z", "orig"), filepath.Join(dir, "a", "link")); err != nil {
+		t.Skipf("cannot create hard links: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "a", "link")); err != nil {
+		t.Fatal(err)
+	} else if _, ok := hardLinkID(info); !ok {
+		t.Skip("hard links aren't recognized on this platform")
+	}
+
+	// Run it in parallel too, the lexically first path must win either way
+	for _, jobs := range []int{1, 4} {
+		root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: jobs})
+		first := child(t, child(t, root, "a"), "link")
+		second := child(t, child(t, root, "z"), "orig")
+		if first.Size != 10 || first.HardLink {
+			t.Errorf("jobs %d: a/link should keep the size, got %d bytes, hard link %t", jobs, first.Size, first.HardLink)
+		}
+		if second.Size != 0 || !second.HardLink {
+			t.Errorf("jobs %d: z/orig should be a 0-byte hard link, got %d bytes, hard link %t", jobs, second.Size, second.HardLink)
+		}
+		if got := child(t, root, "z").Size; got != 0 {
+			t.Errorf("jobs %d: z/ should total 0 bytes, got %d", jobs, got)
+		}
+		if root.Size != 13 {
+			t.Errorf("jobs %d: root should total 13 bytes, got %d", jobs, root.Size)
+		}
+	}
+
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, CountLinks: true})
+	if root.Size != 23 {
+		t.Errorf("with -count-links the root should total 23 bytes, got %d", root.Size)
+	}
+}
+
+func TestPrintFileTree(t *testing.T) {
+	file := func(name string, size int64) *FileInfo {
+		return &FileInfo{Name: name, Size: size}
+	}
+	dir := func(name string, children ...*FileInfo) *FileInfo {
+		node := &FileInfo{Name: name, IsDir: true, Children: children}
+		for _, c := range children {
+			node.Size += c.Size
+			if c.IsDir {
+				node.Count += c.Count
+			} else {
+				node.Count++
+			}
+		}
+		return node
+	}
+
+	tests := []struct {
+		name  string
+		root  *FileInfo
+		style treeStyle
+		want  string
+	}{
+		{
+			name:  "lone file",
+			root:  file("a.txt", 5),
+			style: boxTree,
+			want:  "a.txt (5 B)\n",
+		},
+		{
+			name:  "empty directory",
+			root:  dir("empty"),
+			style: boxTree,
+			want:  "empty/ (0 B, 0 files)\n",
+		},
+		{
+			name:  "one level",
+			root:  dir("root", file("a", 1), file("b", 2)),
+			style: boxTree,
+			want: "root/ (3 B, 2 files)\n" +
+				"    ├── a (1 B)\n" +
+				"    └── b (2 B)\n",
+		},
+		{
+			name: "nested, vertical line only below non-last entries",
+			root: dir("root",
+				dir("x", dir("y", file("deep", 1)), file("after", 2)),
+				dir("z", file("last", 3))),
+			style: boxTree,
+			want: "root/ (6 B, 3 files)\n" +
+				"    ├── x/ (3 B, 2 files)\n" +
+				"    │   ├── y/ (1 B, 1 file)\n" +
+				"    │   │   └── deep (1 B)\n" +
+				"    │   └── after (2 B)\n" +
+				"    └── z/ (3 B, 1 file)\n" +
+				"        └── last (3 B)\n",
+		},
+		{
+			name:  "ascii",
+			root:  dir("root", dir("x", file("a", 1)), file("b", 1024)),
+			style: asciiTree,
+			want: "root/ (1.00 KB, 2 files)\n" +
+				"    |-- x/ (1 B, 1 file)\n" +
+				"    |   `-- a (1 B)\n" +
+				"    `-- b (1.00 KB)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			printFileTree(&b, tt.root, nil, "", true, &TreeOptions{
+				Format:       SizeFormat{Precision: 2},
+				Style:        tt.style,
+				SummaryDepth: -1,
+			})
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"img1", "img2", -1},
+		{"img2", "img10", -1},
+		{"img10", "img2", 1},
+		{"a9b", "a10a", -1},
+		{"v1.2.10", "v1.2.9", 1},
+		{"x", "x1", -1},
+		{"", "a", -1},
+		{"same", "same", 0},
+		// Leading zeros don't change a number's value
+		{"img007", "img7", 0},
+		{"img007", "img10", -1},
+		{"00", "0", 0},
+		// Runs longer than any integer type
+		{"f99999999999999999999", "f100000000000000000000", -1},
+		// Case-sensitive, like strings.Compare; SortByNatural lowercases first
+		{"B", "a", -1},
+		{"img1", "IMG2", 1},
+	}
+	for _, tt := range tests {
+		if got := naturalCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got, want := naturalLess(tt.a, tt.b), tt.want < 0; got != want {
+			t.Errorf("naturalLess(%q, %q) = %t, want %t", tt.a, tt.b, got, want)
+		}
+	}
+
+	names := []string{"img1", "img10", "img2"}
+	slices.SortFunc(names, naturalCompare)
+	if want := []string{"img1", "img2", "img10"}; !slices.Equal(names, want) {
+		t.Errorf("sorted to %v, want %v", names, want)
+	}
+}
+
+func TestSortByNatural(t *testing.T) {
+	root := &FileInfo{Name: "root", IsDir: true}
+	for _, name := range []string{"File10", "file2", "IMG03", "img1", "dir10", "Dir9"} {
+		root.Children = append(root.Children, &FileInfo{Name: name, IsDir: strings.HasPrefix(strings.ToLower(name), "dir")})
+	}
+	sortFileTree(root, SortByNatural, false)
+	// Folders first, ignoring case
+	want := []string{"Dir9", "dir10", "file2", "File10", "img1", "IMG03"}
+	if got := childNames(root); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFromStdinMissingPath(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "abc"})
+	missing := filepath.Join(dir, "missing")
+
+	stdout, stderr, status := runFilesize(t, filepath.Join(dir, "a.txt")+"\n\n"+missing+"\n", "-from-stdin")
+	if status != exitPartial {
+		t.Errorf("exit status %d, want %d", status, exitPartial)
+	}
+	if !strings.Contains(stderr, "Warning: skipping '"+missing+"'") {
+		t.Errorf("no warning about the missing path on stderr:\n%s", stderr)
+	}
+	if want := "a.txt (3 B)\n"; !strings.HasPrefix(stdout, want) {
+		t.Errorf("output starts\n%s\nwant\n%s", stdout, want)
+	}
+
+	paths, skipped := readPathList(strings.NewReader("a\r\n\n" + missing + "\n"))
+	if len(paths) != 0 || len(skipped) != 2 || skipped[1].Path != missing || !errors.Is(skipped[1].Err, os.ErrNotExist) {
+		t.Errorf("got paths %v, skipped %v", paths, skipped)
+	}
+
+	if _, _, status := runFilesize(t, filepath.Join(dir, "a.txt")+"\n", "-from-stdin"); status != 0 {
+		t.Errorf("exit status %d with only existing paths, want 0", status)
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"top.txt":          "x",
+		"sub/deep/file.go": "x",
+	})
+
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, Relative: true})
+	sub := child(t, root, "sub")
+	deep := child(t, sub, "deep")
+	for node, want := range map[*FileInfo]string{
+		root:                      ".",
+		child(t, root, "top.txt"): "top.txt",
+		sub:                       "sub",
+		deep:                      "sub/deep",
+		child(t, deep, "file.go"): "sub/deep/file.go",
+	} {
+		if node.OutPath != want {
+			t.Errorf("%s is shown as %q, want %q", node.Path, node.OutPath, want)
+		}
+	}
+
+	jsonRoot := convertToJSON(root, SizeFormat{})
+	if jsonRoot.Path != "." {
+		t.Errorf("JSON root path %q, want \".\"", jsonRoot.Path)
+	}
+	for _, c := range jsonRoot.Children {
+		if c.Name == "sub" {
+			if got := c.Children[0].Children[0].Path; got != "sub/deep/file.go" {
+				t.Errorf("JSON nested path %q, want \"sub/deep/file.go\"", got)
+			}
+		}
+	}
+
+	stdout, _, status := runFilesize(t, "", "-relative", "-flat", dir)
+	if status != 0 {
+		t.Fatalf("exit status %d", status)
+	}
+	for _, want := range []string{"  sub/deep\n", "  sub\n", "  .\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("-flat output lacks %q:\n%s", want, stdout)
+		}
+	}
+	if strings.Contains(stdout, dir) {
+		t.Errorf("-flat output shows the absolute path:\n%s", stdout)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30m", 30 * time.Minute, false},
+		{"12h", 12 * time.Hour, false},
+		{"1d", 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{" 7d ", 7 * 24 * time.Hour, false},
+		{"0d", 0, true},
+		{"0s", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"10", 0, true},
+		{"infd", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAgeFilterBoundaries(t *testing.T) {
+	now := time.Now()
+	hour := time.Hour
+	cutoff := now.Add(-hour)
+	older := &scanner{modifiedBefore: cutoff}
+	newer := &scanner{modifiedAfter: cutoff}
+	tests := []struct {
+		name         string
+		mtime        time.Time
+		older, newer bool
+	}{
+		{"exactly now", now, false, true},
+		{"in the future", now.Add(hour), false, true},
+		{"just inside the age", cutoff.Add(time.Nanosecond), false, true},
+		// Exactly the age old is neither older nor newer than it
+		{"exactly the age", cutoff, false, false},
+		{"just past the age", cutoff.Add(-time.Nanosecond), true, false},
+		{"long ago", now.Add(-1000 * hour), true, false},
+	}
+	for _, tt := range tests {
+		if got := older.wantsModTime(tt.mtime); got != tt.older {
+			t.Errorf("%s: -older-than 1h wants it = %t, want %t", tt.name, got, tt.older)
+		}
+		if got := newer.wantsModTime(tt.mtime); got != tt.newer {
+			t.Errorf("%s: -newer-than 1h wants it = %t, want %t", tt.name, got, tt.newer)
+		}
+	}
+	if !(&scanner{}).wantsModTime(now) {
+		t.Errorf("without an age filter every file should count")
+	}
+
+	// A scan measures ages from its own start, so a file written right
+	// before it counts as new, never as old
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"now.txt": "x", "old/a.txt": "xx", "future.txt": "xxx"})
+	for name, mtime := range map[string]time.Time{"old/a.txt": now.Add(-2 * hour), "future.txt": now.Add(hour)} {
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, NewerThan: hour})
+	if got := filePaths(t, root); !slices.Equal(got, []string{"future.txt", "now.txt"}) || root.Size != 4 {
+		t.Errorf("-newer-than 1h kept %v (%d B), want future.txt and now.txt (4 B)", got, root.Size)
+	}
+	root, _ = scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, OlderThan: hour})
+	if got := filePaths(t, root); !slices.Equal(got, []string{"old/a.txt"}) || root.Size != 2 {
+		t.Errorf("-older-than 1h kept %v (%d B), want old/a.txt (2 B)", got, root.Size)
+	}
+}
+
+func TestFileTarget(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "a.txt (3 B)\n"},
+		{[]string{"-top", "3"}, "         3 B  " + file + "\n"},
+		{[]string{"-relative", "-top", "3"}, "         3 B  a.txt\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, status := runFilesize(t, "", append(tt.args, file)...)
+		if status != 0 {
+			t.Errorf("%v: exit status %d, stderr:\n%s", tt.args, status, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: got\n%q\nwant\n%q", tt.args, stdout, tt.want)
+		}
+	}
+
+	root, _ := scanTree(t, file, nil)
+	if root.IsDir || root.Size != 3 || root.Name != "a.txt" || len(root.Children) != 0 {
+		t.Errorf("got %+v, want the lone file a.txt of 3 B", root)
+	}
+}
+
+func TestSymlinkedRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"real/f": "abc"})
+	real, err := filepath.EvalSymlinks(filepath.Join(dir, "real"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("real", link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	tests := []struct {
+		resolve    bool
+		name, path string
+		symlink    bool
+		output     string
+	}{
+		{false, "link", link, true, "link/ -> real (3 B, 1 file)\n    └── f (3 B)\n"},
+		{true, "real", real, false, "real/ (3 B, 1 file)\n    └── f (3 B)\n"},
+	}
+	for _, tt := range tests {
+		root, _ := scanTree(t, link, &ScanOptions{MaxDepth: -1, Jobs: 1, ResolveRoot: tt.resolve})
+		if root.Name != tt.name || root.Path != tt.path || root.IsSymlink != tt.symlink {
+			t.Errorf("-resolve-root=%t: root %s at %s, symlink %t; want %s at %s, symlink %t",
+				tt.resolve, root.Name, root.Path, root.IsSymlink, tt.name, tt.path, tt.symlink)
+		}
+		// The link is followed either way
+		if f := child(t, root, "f"); f.Path != filepath.Join(tt.path, "f") || root.Size != 3 {
+			t.Errorf("-resolve-root=%t: file at %s, total %d B", tt.resolve, f.Path, root.Size)
+		}
+
+		stdout, _, status := runFilesize(t, "", fmt.Sprintf("-resolve-root=%t", tt.resolve), link)
+		if status != 0 || stdout != tt.output {
+			t.Errorf("-resolve-root=%t: exit status %d, output\n%s\nwant\n%s", tt.resolve, status, stdout, tt.output)
+		}
+	}
+}
+
+func TestUsageExitStatus(t *testing.T) {
+	_, stderr, _ := runFilesize(t, "", "-h")
+	for _, status := range []int{0, 1, exitPartial, exitStopped} {
+		if !strings.Contains(stderr, fmt.Sprintf("\n  %d\t", status)) {
+			t.Errorf("usage doesn't list exit status %d:\n%s", status, stderr)
+		}
+	}
+}
+
+func TestPruneEmptyWithFilter(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"src/a.go": "xy", "docs/r.md": "x"})
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scan keeps directories the filter leaves without files
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, Extensions: map[string]bool{".go": true}})
+	if got, want := childNames(root), []string{"docs", "empty", "src"}; !slices.Equal(got, want) {
+		t.Errorf("scanned %v, want %v", got, want)
+	}
+	if docs := child(t, root, "docs"); docs.Count != 0 || docs.Size != 0 || len(docs.Children) != 0 {
+		t.Errorf("docs counts %d files, %d B", docs.Count, docs.Size)
+	}
+	if root.Count != 1 || root.Size != 2 {
+		t.Errorf("total %d files, %d B; want 1 file, 2 B", root.Count, root.Size)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-ext", "go"}, "    └── src/ (2 B, 1 file)\n        └── a.go (2 B)\n"},
+		{[]string{"-ext", "go", "-prune-empty=false"}, "    ├── docs/ (0 B, 0 files)\n    ├── empty/ (0 B, 0 files)\n" +
+			"    └── src/ (2 B, 1 file)\n        └── a.go (2 B)\n"},
+	}
+	for _, tt := range tests {
+		stdout, _, status := runFilesize(t, "", append(tt.args, dir)...)
+		_, body, _ := strings.Cut(stdout, "\n") // After the root line
+		if status != 0 || body != tt.want {
+			t.Errorf("%v: exit status %d, output\n%s\nwant\n%s", tt.args, status, body, tt.want)
+		}
+	}
+}
+
+func TestMachineOutputSlashes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/b/c.txt": "x", "a/d.txt": "x", "e.txt": "x"})
+
+	for _, relative := range []bool{false, true} {
+		root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: -1, Jobs: 1, Relative: relative})
+		var want []string
+		walkRows(root, 0, func(node *FileInfo, depth int) error {
+			want = append(want, filepath.ToSlash(node.OutPath))
+			return nil
+		})
+		leaf := filepath.ToSlash(filepath.Join(dir, "a", "b", "c.txt"))
+		if relative {
+			leaf = "a/b/c.txt"
+		}
+		if !slices.Contains(want, leaf) {
+			t.Fatalf("no %s among %v", leaf, want)
+		}
+
+		var jsonOut strings.Builder
+		if err := writeJSON(&jsonOut, []*FileInfo{root}, SizeFormat{}, false, JSONOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		var doc JSONDocument
+		if err := json.Unmarshal([]byte(jsonOut.String()), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var jsonPaths []string
+		var collect func(node *JSONFileInfo)
+		collect = func(node *JSONFileInfo) {
+			jsonPaths = append(jsonPaths, node.Path)
+			for _, c := range node.Children {
+				collect(c)
+			}
+		}
+		collect(doc.Root)
+
+		var csvOut strings.Builder
+		if err := writeCSVTo(&csvOut, []*FileInfo{root}, SizeFormat{}, false); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(strings.NewReader(csvOut.String())).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var csvPaths []string
+		for _, record := range records[1:] {
+			csvPaths = append(csvPaths, record[0])
+		}
+
+		var tsvOut strings.Builder
+		if err := writeTSV(&tsvOut, []*FileInfo{root}); err != nil {
+			t.Fatal(err)
+		}
+		var tsvPaths []string
+		for _, line := range strings.Split(strings.TrimSuffix(tsvOut.String(), "\n"), "\n") {
+			path, _, _ := strings.Cut(line, "\t")
+			tsvPaths = append(tsvPaths, path)
+		}
+
+		var ndjsonOut strings.Builder
+		if err := writeNDJSON(&ndjsonOut, []*FileInfo{root}, SizeFormat{}); err != nil {
+			t.Fatal(err)
+		}
+		var ndjsonPaths []string
+		for dec := json.NewDecoder(strings.NewReader(ndjsonOut.String())); dec.More(); {
+			var entry NDJSONEntry
+			if err := dec.Decode(&entry); err != nil {
+				t.Fatal(err)
+			}
+			ndjsonPaths = append(ndjsonPaths, entry.Path)
+		}
+
+		for format, got := range map[string][]string{"JSON": jsonPaths, "NDJSON": ndjsonPaths, "CSV": csvPaths, "TSV": tsvPaths} {
+			// JSON children are in the same order as the rows
+			if !slices.Equal(got, want) {
+				t.Errorf("relative=%t: %s paths\n%v\nwant\n%v", relative, format, got, want)
+			}
+		}
+	}
+}
+
+func TestCSVLineEndings(t *testing.T) {
+	root := &FileInfo{Name: "root", Path: "root", OutPath: "root", IsDir: true, Size: 1, Count: 1}
+	root.Children = []*FileInfo{{Name: "a\r\nb", Path: "root/a\r\nb", OutPath: "root/a\r\nb", Size: 1}}
+
+	tests := []struct {
+		crlf bool
+		want string
+	}{
+		{false, "path,name,size,sizeStr,isDir,depth\nroot,root,1,1 B,true,0\n\"root/a\r\nb\",\"a\r\nb\",1,1 B,false,1\n"},
+		{true, "path,name,size,sizeStr,isDir,depth\r\nroot,root,1,1 B,true,0\r\n\"root/a\r\nb\",\"a\r\nb\",1,1 B,false,1\r\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := writeCSVTo(&b, []*FileInfo{root}, SizeFormat{}, tt.crlf); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("crlf=%t: got\n%q\nwant\n%q", tt.crlf, got, tt.want)
+		}
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"f": "x"})
+	csvFile := filepath.Join(t.TempDir(), "out.csv")
+	if _, stderr, status := runFilesize(t, "", "-csv", csvFile, "-bom", "-crlf", dir); status != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", status, stderr)
+	}
+	data, err := os.ReadFile(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.HasPrefix(got, utf8BOM+"path,name,") || strings.Count(got, "\r\n") != 3 || strings.Contains(got, "\r\r") {
+		t.Errorf("-csv with -bom -crlf wrote\n%q", got)
+	}
+	if _, stderr, status := runFilesize(t, "", "-crlf", "-output", filepath.Join(t.TempDir(), "out.txt"), dir); status != 1 ||
+		!strings.Contains(stderr, "-crlf requires -csv or -format csv") {
+		t.Errorf("-crlf with a tree -output: exit status %d, stderr:\n%s", status, stderr)
+	}
+}
+
+func TestCountSymlinksSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "x", "sub/b": "x"})
+	if err := os.Symlink("a", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	_, stderr, status := runFilesize(t, "", "-summary", "-count-symlinks", dir)
+	if status != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", status, stderr)
+	}
+	for _, want := range []string{
+		" across 3 files in 2 directories (" + dir + ")\n",
+		" across 3 files (1 symlink) in 2 directories\n",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr lacks %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestJSONFileNeedsEquals(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.json")
+	_, stderr, status := runFilesize(t, "", "-json", out)
+	if status != 1 || !strings.Contains(stderr, "use -json="+out) {
+		t.Errorf("-json FILE: exit status %d, stderr:\n%s", status, stderr)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Errorf("-json FILE created %s", out)
+	}
+
+	dir := filepath.Join(t.TempDir(), "data.json")
+	writeTree(t, dir, map[string]string{"f": "x"})
+	if stdout, stderr, status := runFilesize(t, "", "-json", dir); status != 0 || !strings.HasPrefix(stdout, "{") {
+		t.Errorf("-json with a directory named *.json: exit status %d, stderr:\n%s", status, stderr)
+	}
+	if _, stderr, status := runFilesize(t, "", "-json="+out, dir); status != 0 {
+		t.Errorf("-json=FILE: exit status %d, stderr:\n%s", status, stderr)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("-json=FILE didn't write the file: %v", err)
+	}
+	if _, stderr, status := runFilesize(t, "", "-md", filepath.Join(t.TempDir(), "tree.md")); status != 1 || !strings.Contains(stderr, "use -md=") {
+		t.Errorf("-md FILE: exit status %d, stderr:\n%s", status, stderr)
+	}
+}
+
+func TestDepthOnlyLimitsDisplay(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"small.txt":              "x",
+		"src/pkg/deep/big.bin":   strings.Repeat("x", 100),
+		"src/pkg/deep/other.bin": "xx",
+	})
+
+	// The scan keeps everything whatever MaxDepth says
+	root, _ := scanTree(t, dir, &ScanOptions{MaxDepth: 1, Jobs: 1})
+	if got := filePaths(t, root); !slices.Contains(got, "src/pkg/deep/big.bin") {
+		t.Errorf("scanned %v, want the deep files too", got)
+	}
+	limited := limitDepth(root, 1)
+	if src := child(t, limited, "src"); len(src.Children) != 0 || src.Size != 102 || src.Count != 2 {
+		t.Errorf("src cut at depth 1 has %d children, %d B, %d files", len(src.Children), src.Size, src.Count)
+	}
+	if len(child(t, root, "src").Children) == 0 {
+		t.Errorf("limitDepth changed the original tree")
+	}
+
+	stdout, _, status := runFilesize(t, "", "-depth", "1", "-sort", "size", dir)
+	if want := "    ├── src/ (102 B, 2 files)\n    └── small.txt (1 B)\n"; status != 0 || !strings.HasSuffix(stdout, want) {
+		t.Errorf("-depth 1: exit status %d, output\n%s\nwant it to end with\n%s", status, stdout, want)
+	}
+	stdout, _, status = runFilesize(t, "", "-depth", "1", "-flat", "-relative", dir)
+	if want := "       103 B  .\n       102 B  src\n"; status != 0 || stdout != want {
+		t.Errorf("-depth 1 -flat: exit status %d, output\n%q\nwant\n%q", status, stdout, want)
+	}
+
+	csvFile := filepath.Join(t.TempDir(), "out.csv")
+	if _, stderr, status := runFilesize(t, "", "-depth", "1", "-csv", csvFile, dir); status != 0 {
+		t.Fatalf("-depth 1 -csv: exit status %d, stderr:\n%s", status, stderr)
+	}
+	if data, err := os.ReadFile(csvFile); err != nil || !strings.Contains(string(data), "big.bin") {
+		t.Errorf("-depth 1 -csv left out the deep files: %v\n%s", err, data)
+	}
+
+	for _, args := range [][]string{
+		{"-depth", "1", "-top", "3"},
+		{"-no-recurse", "-dupes"},
+		{"-depth", "2", "-format", "ndjson"},
+	} {
+		_, stderr, status := runFilesize(t, "", append(args, dir)...)
+		if status != 1 || !strings.Contains(stderr, "only limit the tree and cannot be used with") {
+			t.Errorf("%v: exit status %d, stderr:\n%s", args, status, stderr)
+		}
+	}
+}
+
+func TestFormatShorthandConflicts(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-json", "-html", "x.html"}, "Error: -json cannot be used with -html\n"},
+		{[]string{"-format", "csv", "-md"}, "Error: -md cannot be used with -format csv\n"},
+		{[]string{"-html=a.html", "-json=b.json"}, "Error: -json cannot be used with -html\n"},
+		{[]string{"-format", "json", "-output", "a.json", "-json=b.json"}, "Error: -json=b.json cannot be used with -output a.json\n"},
+		{[]string{"-md=a.md", "-format", "md", "-output", "b.md"}, "Error: -md=a.md cannot be used with -output b.md\n"},
+	}
+	for _, tt := range tests {
+		_, stderr, status := runFilesize(t, "", append(tt.args, dir)...)
+		if status != 1 || stderr != tt.want {
+			t.Errorf("%v: exit status %d, stderr %q, want %q", tt.args, status, stderr, tt.want)
+		}
+	}
+}
+
+func TestStoppedAtOnce(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fx")
+	writeTree(t, dir, map[string]string{"a/b": "x"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	root, stats, err := buildFileTree(ctx, dir, &ScanOptions{MaxDepth: -1, Jobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.IsDir || stats.Stopped == nil {
+		t.Errorf("stopped scan: directory %t, stopped %v", root.IsDir, stats.Stopped)
+	}
+
+	stdout, stderr, status := runFilesize(t, "", "-timeout", "1ns", dir)
+	if status != exitStopped || stdout != "fx/ (0 B, 0 files)\n" || !strings.Contains(stderr, "scan stopped after the -timeout") {
+		t.Errorf("-timeout 1ns: exit status %d, output %q, stderr:\n%s", status, stdout, stderr)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often progress events are emitted
+const progressInterval = 500 * time.Millisecond
+
+// ProgressEvent is one machine-readable progress update
+type ProgressEvent struct {
+	Scanned int64  `json:"scanned"`
+	Current string `json:"current"`
+	Elapsed string `json:"elapsed"`
+	Done    bool   `json:"done,omitempty"`
+}
+
+// progressReporter tracks scan progress and periodically writes it to a
+// writer as newline-delimited JSON events
+type progressReporter struct {
+	mu      sync.Mutex
+	scanned int64
+	current string
+	start   time.Time
+	enc     *json.Encoder
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newProgressReporter(w io.Writer) *progressReporter {
+	p := &progressReporter{
+		start: time.Now(),
+		enc:   json.NewEncoder(w),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// update records that path has been scanned. It is safe to call on a nil reporter.
+func (p *progressReporter) update(path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.scanned++
+	p.current = path
+	p.mu.Unlock()
+}
+
+func (p *progressReporter) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.emit(false)
+		case <-p.stop:
+			p.emit(true)
+			return
+		}
+	}
+}
+
+func (p *progressReporter) emit(done bool) {
+	p.mu.Lock()
+	event := ProgressEvent{
+		Scanned: p.scanned,
+		Current: p.current,
+		Elapsed: time.Since(p.start).Round(time.Millisecond).String(),
+		Done:    done,
+	}
+	p.mu.Unlock()
+
+	p.enc.Encode(event)
+}
+
+// finish emits a final event and stops the reporter. It is safe to call on a nil reporter.
+func (p *progressReporter) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// retryBaseDelay is the wait before the first retry, doubled on each attempt
+const retryBaseDelay = 100 * time.Millisecond
+
+// isRetryable reports whether err is a transient failure worth retrying.
+// Permanent errors such as ENOENT or EACCES are never retried.
+func isRetryable(err error) bool {
+	if transientErrno(err) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// withRetry runs op, retrying transient errors with exponential backoff
+// up to the configured number of times. When ctx is done it stops
+// waiting and returns the last error.
+func (s *scanner) withRetry(ctx context.Context, op func() error) error {
+	err := op()
+	delay := retryBaseDelay
+	for attempt := 0; err != nil && attempt < s.opts.Retries && isRetryable(err); attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+
+		err = op()
+		if err == nil {
+			s.mu.Lock()
+			s.stats.Recovered++
+			s.mu.Unlock()
+		}
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// transientErrno reports no errno as transient where the Unix ones don't
+// exist; timeouts are still recognized by isRetryable
+func transientErrno(err error) bool {
+	return false
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	transient := fmt.Errorf("read: %w", os.ErrDeadlineExceeded)
+
+	// Fails once, then works
+	s := &scanner{opts: &ScanOptions{Retries: 3}}
+	calls := 0
+	err := s.withRetry(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || calls != 2 || s.stats.Recovered != 1 {
+		t.Errorf("got %v after %d calls, %d recovered; want success after 2 calls, 1 recovered", err, calls, s.stats.Recovered)
+	}
+
+	// Permanent errors aren't retried
+	calls = 0
+	err = s.withRetry(context.Background(), func() error {
+		calls++
+		return os.ErrNotExist
+	})
+	if !errors.Is(err, os.ErrNotExist) || calls != 1 {
+		t.Errorf("got %v after %d calls, want ErrNotExist after 1", err, calls)
+	}
+
+	// A stopped scan doesn't wait out the backoff of 10 retries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s = &scanner{opts: &ScanOptions{Retries: 10}}
+	calls = 0
+	start := time.Now()
+	err = s.withRetry(ctx, func() error {
+		calls++
+		return transient
+	})
+	if !errors.Is(err, os.ErrDeadlineExceeded) || calls != 1 || time.Since(start) > retryBaseDelay {
+		t.Errorf("got %v after %d calls in %v, want the error at once", err, calls, time.Since(start))
+	}
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// transientErrno reports whether err is an interrupted system call, a
+// resource that is temporarily unavailable or a timed out operation
+func transientErrno(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ETIMEDOUT)
+}
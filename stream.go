@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// streamFlags are the flags -stream can be given with: the scan options
+// streamTotals honors, where and how the sizes are written, and which
+// targets are read. Any other flag would be silently ignored.
+var streamFlags = map[string]bool{
+	"stream":         true,
+	"exclude":        true,
+	"exclude-hidden": true,
+	"count-links":    true,
+	"apparent":       true,
+	"depth":          true,
+	"no-recurse":     true,
+	"relative":       true,
+	"output":         true,
+	"format":         true, // Only tree, checked on its own
+	"unit":           true,
+	"si":             true,
+	"iec":            true,
+	"precision":      true,
+	"verbose":        true,
+	"from-stdin":     true,
+	"no-config":      true,
+}
+
+// streamDir is a directory -stream is still adding up
+type streamDir struct {
+	outPath string
+	size    int64
+}
+
+// streamTotals walks root in a single filepath.WalkDir pass and writes
+// the total size of each directory to w as soon as all of its contents
+// have been seen, so every directory comes after its subdirectories.
+// Only the directories on the path being walked are held in memory, not
+// the tree, which is what makes it usable on huge filesystems; the price
+// is that nothing can be sorted. Of the ScanOptions, only Exclude,
+// SkipHidden, CountLinks, DiskUsage, MaxDepth (for what's printed) and
+// Relative apply. Entries that couldn't be read are returned.
+func streamTotals(w io.Writer, root string, opts *ScanOptions, f SizeFormat) ([]SkippedEntry, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	// WalkDir doesn't follow a symlinked root, the paths are shown under it
+	walkRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var skipped []SkippedEntry
+	var open []*streamDir
+	seen := make(map[fileID]bool) // Only files with several hard links
+
+	// finish pops the directories deeper than depth, which the walk has
+	// left, and adds each to its parent
+	finish := func(depth int) {
+		for len(open) > depth {
+			dir := open[len(open)-1]
+			open = open[:len(open)-1]
+			if len(open) > 0 {
+				open[len(open)-1].size += dir.size
+			}
+			if opts.MaxDepth < 0 || len(open) <= opts.MaxDepth {
+				fmt.Fprintf(w, "%12s  %s\n", formatSize(dir.size, f), dir.outPath)
+			}
+		}
+	}
+
+	err = filepath.WalkDir(walkRoot, func(p string, entry fs.DirEntry, err error) error {
+		rel := strings.TrimPrefix(p[len(walkRoot):], string(filepath.Separator))
+		depth := 0
+		if rel != "" {
+			depth = strings.Count(rel, string(filepath.Separator)) + 1
+		}
+		p = filepath.Join(absRoot, rel)
+		if err != nil {
+			if entry == nil {
+				return err // The root itself can't be read
+			}
+			// A directory that can't be listed is counted empty
+			skipped = append(skipped, SkippedEntry{Path: p, Err: err})
+			return nil
+		}
+		if depth > 0 && (matchesAny(entry.Name(), opts.Exclude) ||
+			opts.SkipHidden && strings.HasPrefix(entry.Name(), ".")) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		finish(depth)
+
+		outPath := p
+		if opts.Relative {
+			outPath = path.Join(".", filepath.ToSlash(rel))
+		}
+		if entry.IsDir() {
+			open = append(open, &streamDir{outPath: outPath})
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			skipped = append(skipped, SkippedEntry{Path: p, Err: err})
+			return nil
+		}
+		if id, ok := hardLinkID(info); ok && !opts.CountLinks {
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+		}
+		size := info.Size()
+		if opts.DiskUsage {
+			size = diskUsage(info)
+		}
+		if len(open) == 0 {
+			// A lone file was given
+			fmt.Fprintf(w, "%12s  %s\n", formatSize(size, f), outPath)
+			return nil
+		}
+		open[len(open)-1].size += size
+		return nil
+	})
+	finish(0)
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// streamOutput runs streamTotals on each target and writes to the
+// -output file, or stdout if outputFile is empty, and returns the exit
+// status
+func streamOutput(targetDirs []string, outputFile string, opts *ScanOptions, f SizeFormat, verbose bool) int {
+	file := os.Stdout
+	if outputFile != "" {
+		var err error
+		file, err = os.Create(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+	}
+	out := bufio.NewWriter(file)
+	defer out.Flush()
+
+	var skipped []SkippedEntry
+	for _, targetDir := range targetDirs {
+		s, err := streamTotals(out, targetDir, opts, f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error building file tree: %v\n", err)
+			return 1
+		}
+		skipped = append(skipped, s...)
+	}
+	out.Flush() // Before the warnings, when both go to the terminal
+	if len(skipped) > 0 {
+		reportSkipped(os.Stderr, skipped, verbose)
+		return exitPartial
+	}
+	return 0
+}
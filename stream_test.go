@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamRejectsUnsupportedFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/b.txt": "xy"})
+
+	for _, args := range [][]string{
+		{"-ext", "go"},
+		{"-include", "*.txt"},
+		{"-regex", "b"},
+		{"-older-than", "1d"},
+		{"-newer-than", "1d"},
+		{"-gitignore"},
+		{"-follow"},
+		{"-same-device"},
+		{"-skip-fstypes", "proc"},
+		{"-timeout", "1m"},
+		{"-top", "3"},
+		{"-flat"},
+		{"-watch"},
+		{"-format", "json"},
+		{"-csv", "out.csv"},
+		{"-save", "out.json"},
+		{"-html", "out.html"},
+		{"-dump-data", "out.js"},
+		{"-treemap", "out.svg"},
+		{"-size-map", "out.json"},
+		{"-hash-output"},
+		{"-min-size", "1K"},
+		{"-dupes"},
+		{"-summary"},
+		{"-type", "f"},
+		{"-by-ext"},
+		{"-diff", "old.json"},
+	} {
+		_, stderr, status := runFilesize(t, "", append(append([]string{"-stream"}, args...), dir)...)
+		if status != 1 || !strings.Contains(stderr, "Error: -stream cannot be used with") || !strings.Contains(stderr, args[0]) {
+			t.Errorf("-stream %v: exit status %d, stderr:\n%s", args, status, stderr)
+		}
+	}
+
+	stdout, _, status := runFilesize(t, "", "-stream", "-relative", "-exclude", "*.tmp", dir)
+	if want := "         2 B  a\n         2 B  .\n"; status != 0 || stdout != want {
+		t.Errorf("-stream: exit status %d, output\n%q\nwant\n%q", status, stdout, want)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+)
+
+// writeTreemap writes a standalone HTML page that draws the trees as a
+// squarified treemap: each entry is a rectangle with an area proportional
+// to its size, directories hold their children's rectangles, and clicking
+// a directory zooms into it. The layout is computed in the browser from
+// the same JSON the HTML output embeds, so it follows the window size.
+func writeTreemap(roots []*FileInfo, outputFile, title string, f SizeFormat, opts JSONOptions) error {
+	jsonBytes, err := marshalTreeData(roots, f, opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>File Size Treemap - %s</title>
+    <style>
+        html, body {
+            height: 100%%;
+            margin: 0;
+        }
+        body {
+            display: flex;
+            flex-direction: column;
+            font-family: -apple-system, 'Segoe UI', Helvetica, Arial, sans-serif;
+            font-size: 12px;
+            background: #222;
+            color: #eee;
+        }
+        #crumbs {
+            padding: 8px 10px;
+            background: #333;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        #crumbs a {
+            color: #8cf;
+            cursor: pointer;
+            text-decoration: none;
+        }
+        #crumbs a:hover {
+            text-decoration: underline;
+        }
+        #map {
+            position: relative;
+            flex: 1;
+            margin: 4px;
+            overflow: hidden;
+        }
+        .cell {
+            position: absolute;
+            box-sizing: border-box;
+            border: 1px solid #222;
+            overflow: hidden;
+        }
+        .dir {
+            background: #444;
+            cursor: zoom-in;
+        }
+        .dir:hover {
+            border-color: #fff;
+        }
+        .label {
+            padding: 1px 3px;
+            height: 14px;
+            line-height: 14px;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            color: #111;
+            pointer-events: none;
+        }
+        .dir > .label {
+            color: #eee;
+            font-weight: bold;
+        }
+        .omitted {
+            background: #666;
+        }
+    </style>
+</head>
+<body>
+    <div id="crumbs"></div>
+    <div id="map"></div>
+    <script>
+        const treeDocument = %s;
+        // A versioned document wraps the trees, unless written with -legacy-json
+        const treeData = treeDocument.version ? (treeDocument.root || treeDocument.roots) : treeDocument;
+
+        // Several scanned directories are shown side by side under one top level
+        const top = Array.isArray(treeData) ? {
+            name: treeData.map(root => root.name).join(', '),
+            path: '',
+            isDir: true,
+            size: treeData.reduce((sum, root) => sum + root.size, 0),
+            sizeStr: '',
+            children: treeData
+        } : treeData;
+
+        const labelHeight = 16;  // Room for a directory's name above its contents
+        const minSide = 4;       // Rectangles smaller than this aren't split further
+
+        // Zoom path from the top level to the directory being shown
+        let stack = [top];
+
+        // worst returns the largest aspect ratio in a row of areas laid
+        // along a side of the given length; squarify keeps it close to 1
+        function worst(row, side) {
+            const sum = row.reduce((s, item) => s + item.area, 0);
+            const largest = Math.max(...row.map(item => item.area));
+            const smallest = Math.min(...row.map(item => item.area));
+            return Math.max(side * side * largest / (sum * sum), (sum * sum) / (side * side * smallest));
+        }
+
+        // squarify lays out nodes, largest first, in the rectangle x, y,
+        // w, h and returns one {node, x, y, w, h} per node with a size
+        function squarify(nodes, x, y, w, h) {
+            const total = nodes.reduce((s, node) => s + node.size, 0);
+            if (total <= 0 || w <= 0 || h <= 0) {
+                return [];
+            }
+            const scale = w * h / total;
+            const items = nodes.filter(node => node.size > 0)
+                .map(node => ({node: node, area: node.size * scale}))
+                .sort((a, b) => b.area - a.area);
+
+            const rects = [];
+            let row = [];
+            const placeRow = function() {
+                const sum = row.reduce((s, item) => s + item.area, 0);
+                if (w >= h) {
+                    // A column along the left edge
+                    const width = sum / h;
+                    let offset = y;
+                    row.forEach(item => {
+                        const height = item.area / width;
+                        rects.push({node: item.node, x: x, y: offset, w: width, h: height});
+                        offset += height;
+                    });
+                    x += width;
+                    w -= width;
+                } else {
+                    // A row along the top edge
+                    const height = sum / w;
+                    let offset = x;
+                    row.forEach(item => {
+                        const width = item.area / height;
+                        rects.push({node: item.node, x: offset, y: y, w: width, h: height});
+                        offset += width;
+                    });
+                    y += height;
+                    h -= height;
+                }
+                row = [];
+            };
+
+            while (items.length > 0) {
+                const side = Math.min(w, h);
+                if (row.length === 0 || worst(row.concat([items[0]]), side) <= worst(row, side)) {
+                    row.push(items.shift());
+                } else {
+                    placeRow();
+                }
+            }
+            if (row.length > 0) {
+                placeRow();
+            }
+            return rects;
+        }
+
+        // extensionHue picks a stable color per file extension
+        function extensionHue(name) {
+            const dot = name.lastIndexOf('.');
+            const ext = dot > 0 ? name.slice(dot + 1).toLowerCase() : '';
+            let hash = 0;
+            for (let i = 0; i < ext.length; i++) {
+                hash = (hash * 31 + ext.charCodeAt(i)) | 0;
+            }
+            return Math.abs(hash) %% 360;
+        }
+
+        // tooltip shows the path and size, and the file count of a directory
+        function tooltip(node) {
+            let text = (node.path || node.name) + '\n' + node.sizeStr;
+            if (node.isDir) {
+                text += ', ' + node.fileCount + (node.fileCount === 1 ? ' file' : ' files');
+            }
+            return text;
+        }
+
+        // drawNode adds the rectangle of node, and of its children inside
+        // it while they are big enough to see
+        function drawNode(container, node, x, y, w, h) {
+            if (w < 1 || h < 1) {
+                return; // Too small to see or to click
+            }
+            const cell = document.createElement('div');
+            cell.className = 'cell' + (node.isDir ? ' dir' : '') + (node.omitted ? ' omitted' : '');
+            cell.style.left = x + 'px';
+            cell.style.top = y + 'px';
+            cell.style.width = w + 'px';
+            cell.style.height = h + 'px';
+            cell.title = tooltip(node);
+            if (!node.isDir && !node.omitted) {
+                cell.style.background = 'hsl(' + extensionHue(node.name) + ', 55%%, 60%%)';
+            }
+            if (w > 30 && h > labelHeight) {
+                const label = document.createElement('div');
+                label.className = 'label';
+                label.textContent = (node.isDir ? node.name + '/' : node.name) + ' ' + node.sizeStr;
+                cell.appendChild(label);
+            }
+            container.appendChild(cell);
+
+            if (node.isDir) {
+                cell.addEventListener('click', function(e) {
+                    e.stopPropagation();
+                    zoomTo(node);
+                });
+                const children = node.children || [];
+                const innerW = w - 4;
+                const innerH = h - labelHeight - 2;
+                if (children.length > 0 && innerW > minSide && innerH > minSide) {
+                    squarify(children, 1, labelHeight, innerW, innerH).forEach(rect => {
+                        drawNode(cell, rect.node, rect.x, rect.y, rect.w, rect.h);
+                    });
+                }
+            }
+        }
+
+        // zoomTo shows node across the whole map. Its ancestors stay in the
+        // breadcrumbs so the user can go back up.
+        function zoomTo(node) {
+            const index = stack.indexOf(node);
+            if (index >= 0) {
+                stack = stack.slice(0, index + 1);
+            } else {
+                const current = stack[stack.length - 1];
+                const path = findPath(current, node);
+                stack = stack.concat(path.slice(1));
+            }
+            render();
+        }
+
+        // findPath returns the nodes from node down to target, or [] if
+        // target isn't below node
+        function findPath(node, target) {
+            if (node === target) {
+                return [node];
+            }
+            for (const child of node.children || []) {
+                const path = findPath(child, target);
+                if (path.length > 0) {
+                    return [node].concat(path);
+                }
+            }
+            return [];
+        }
+
+        function renderCrumbs() {
+            const crumbs = document.getElementById('crumbs');
+            crumbs.textContent = '';
+            stack.forEach((node, i) => {
+                if (i > 0) {
+                    crumbs.appendChild(document.createTextNode(' / '));
+                }
+                const link = document.createElement('a');
+                // The top shows where the scan started, unless -relative made that '.'
+                link.textContent = i === 0 && node.path && node.path !== '.' ? node.path : node.name;
+                link.addEventListener('click', () => zoomTo(node));
+                crumbs.appendChild(link);
+            });
+            const current = stack[stack.length - 1];
+            if (current.sizeStr) {
+                crumbs.appendChild(document.createTextNode('  (' + current.sizeStr + ')'));
+            }
+        }
+
+        function render() {
+            const map = document.getElementById('map');
+            map.textContent = '';
+            renderCrumbs();
+            const current = stack[stack.length - 1];
+            const children = current.isDir ? (current.children || []) : [current];
+            squarify(children, 0, 0, map.clientWidth, map.clientHeight).forEach(rect => {
+                drawNode(map, rect.node, rect.x, rect.y, rect.w, rect.h);
+            });
+        }
+
+        window.addEventListener('resize', render);
+        document.addEventListener('DOMContentLoaded', render);
+    </script>
+</body>
+</html>
+`, html.EscapeString(title), string(jsonBytes))
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// tuiBarWidth is the width of the share-of-directory bar in -tui
+const tuiBarWidth = 20
+
+// tuiLevel is one directory on the -tui navigation stack
+type tuiLevel struct {
+	dir      *FileInfo
+	children []*FileInfo // dir's children, largest first
+	selected int         // Index of the highlighted child
+	offset   int         // Index of the first visible child
+}
+
+func newTUILevel(dir *FileInfo) *tuiLevel {
+	children := slices.Clone(dir.Children)
+	slices.SortStableFunc(children, func(a, b *FileInfo) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return &tuiLevel{dir: dir, children: children}
+}
+
+// runTUI shows the trees in a full-screen browser, one directory at a
+// time, until the user quits. Several roots are listed under a top level
+// named after all of them.
+func runTUI(roots []*FileInfo, f SizeFormat) error {
+	top := roots[0]
+	if len(roots) > 1 {
+		names := make([]string, len(roots))
+		top = &FileInfo{IsDir: true, Children: roots}
+		for i, root := range roots {
+			names[i] = root.OutPath
+			top.Size += root.Size
+			top.Count += root.Count
+		}
+		top.OutPath = strings.Join(names, ", ")
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	stack := []*tuiLevel{newTUILevel(top)}
+	for {
+		level := stack[len(stack)-1]
+		drawTUI(screen, level, f)
+
+		switch ev := screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventKey:
+			_, height := screen.Size()
+			page := max(height-2, 1)
+			switch {
+			case ev.Key() == tcell.KeyEscape || ev.Key() == tcell.KeyCtrlC || ev.Rune() == 'q':
+				return nil
+			case ev.Key() == tcell.KeyUp || ev.Rune() == 'k':
+				level.selected--
+			case ev.Key() == tcell.KeyDown || ev.Rune() == 'j':
+				level.selected++
+			case ev.Key() == tcell.KeyPgUp:
+				level.selected -= page
+			case ev.Key() == tcell.KeyPgDn:
+				level.selected += page
+			case ev.Key() == tcell.KeyHome:
+				level.selected = 0
+			case ev.Key() == tcell.KeyEnd:
+				level.selected = len(level.children) - 1
+			case ev.Key() == tcell.KeyEnter || ev.Key() == tcell.KeyRight || ev.Rune() == 'l':
+				if len(level.children) == 0 {
+					break
+				}
+				child := level.children[level.selected]
+				if (child.IsDir || child.IsArchive) && !child.Summarized && len(child.Children) > 0 {
+					stack = append(stack, newTUILevel(child))
+				}
+			case ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 ||
+				ev.Key() == tcell.KeyLeft || ev.Rune() == 'h':
+				if len(stack) > 1 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			level.selected = min(max(level.selected, 0), max(len(level.children)-1, 0))
+		}
+	}
+}
+
+// drawTUI draws the header with the directory's path and total, one line
+// per child with its size and share of the directory, and a key help line
+func drawTUI(screen tcell.Screen, level *tuiLevel, f SizeFormat) {
+	screen.Clear()
+	width, height := screen.Size()
+	rows := max(height-2, 0)
+
+	// Keep the selection in view
+	if level.selected < level.offset {
+		level.offset = level.selected
+	}
+	if rows > 0 && level.selected >= level.offset+rows {
+		level.offset = level.selected - rows + 1
+	}
+
+	inverse := tcell.StyleDefault.Reverse(true)
+	dirStyle := tcell.StyleDefault.Foreground(tcell.ColorBlue).Bold(true)
+
+	header := fmt.Sprintf(" %s  %s, %s", level.dir.OutPath, formatSize(level.dir.Size, f),
+		pluralizeCount(level.dir.Count, "file", "files"))
+	drawTUILine(screen, 0, width, inverse, header)
+
+	for row := 0; row < rows && level.offset+row < len(level.children); row++ {
+		i := level.offset + row
+		child := level.children[i]
+
+		name := child.Name
+		style := tcell.StyleDefault
+		if child.IsDir {
+			name += "/"
+			style = dirStyle
+		}
+		if child.IsSymlink && child.LinkTarget != "" {
+			name += " -> " + child.LinkTarget
+		}
+		line := fmt.Sprintf(" %10s %5.1f%% %s  %s", formatSize(child.Size, f),
+			percentOfParent(child, level.dir), sizeBar(child.Size, level.dir.Size, tuiBarWidth, boxTree), name)
+		if i == level.selected {
+			style = inverse
+		}
+		drawTUILine(screen, row+1, width, style, line)
+	}
+	if len(level.children) == 0 && rows > 0 {
+		drawTUILine(screen, 1, width, tcell.StyleDefault.Dim(true), " (empty)")
+	}
+
+	help := " ↑↓ move  → enter  ← up  q quit"
+	if len(level.children) > 0 {
+		help = fmt.Sprintf(" %d/%d %s", level.selected+1, len(level.children), help)
+	}
+	drawTUILine(screen, height-1, width, inverse, help)
+	screen.Show()
+}
+
+// drawTUILine writes text on row y in style, cut off or padded with
+// spaces to the screen width
+func drawTUILine(screen tcell.Screen, y, width int, style tcell.Style, text string) {
+	x := 0
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if x+w > width {
+			break
+		}
+		screen.SetContent(x, y, r, nil, style)
+		x += max(w, 1)
+	}
+	for ; x < width; x++ {
+		screen.SetContent(x, y, ' ', nil, style)
+	}
+}
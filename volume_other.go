@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// volumeSpace is not implemented on this platform
+func volumeSpace(path string) (total, free uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// volumeSpace returns the size of the volume holding path and the bytes
+// on it available to the current user
+func volumeSpace(path string) (total, free uint64, err error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(name, &free, &total, nil); err != nil {
+		return 0, 0, err
+	}
+	return total, free, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long to wait after the last change before
+// scanning again, so a burst of writes causes a single redraw
+const watchDebounce = 500 * time.Millisecond
+
+// clearScreen moves the cursor to the top left and clears the terminal
+const clearScreen = "\x1b[H\x1b[2J"
+
+// dirWatcher watches the directories a scan with opts would read
+type dirWatcher struct {
+	*fsnotify.Watcher
+	opts    *ScanOptions
+	ignores map[string]*gitignore // .gitignore rules in effect inside each watched directory
+}
+
+// watchDirs calls render whenever entries below dirs are created,
+// removed, renamed or written, until interrupted with SIGINT. Entries
+// the scan options leave out aren't watched, and changes to the files
+// in outputs, which render itself writes, are ignored.
+func watchDirs(dirs []string, opts *ScanOptions, outputs []string, render func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	w := &dirWatcher{Watcher: watcher, opts: opts, ignores: make(map[string]*gitignore)}
+
+	roots := make(map[string]bool)
+	for _, dir := range dirs {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		roots[dir] = true
+		if err := w.addRecursive(dir); err != nil {
+			return err
+		}
+	}
+	ownFiles := make(map[string]bool)
+	for _, output := range outputs {
+		if output == "" {
+			continue
+		}
+		if output, err := filepath.Abs(output); err == nil {
+			ownFiles[output] = true
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || ownFiles[event.Name] {
+				continue // Permissions don't change sizes, and redrawing would loop
+			}
+			info, statErr := os.Stat(event.Name)
+			isDir := statErr == nil && info.IsDir()
+			if !roots[event.Name] && w.excluded(event.Name, isDir) {
+				continue
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(w.ignores, event.Name)
+			}
+			if event.Has(fsnotify.Create) && isDir {
+				// New subdirectories need watches of their own
+				if err := w.addRecursive(event.Name); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: cannot watch %s: %v\n", event.Name, err)
+				}
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		case <-debounce:
+			debounce = nil
+			render()
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// excluded reports whether the scan leaves out the entry at path, which
+// is below a watched directory, because of -exclude, -exclude-hidden or
+// -gitignore
+func (w *dirWatcher) excluded(path string, isDir bool) bool {
+	name := filepath.Base(path)
+	if matchesAny(name, w.opts.Exclude) || w.opts.SkipHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	return w.ignores[filepath.Dir(path)].ignored(path, isDir)
+}
+
+// addRecursive watches root and every directory below it the scan
+// doesn't leave out, or just root if it is a file. Directories that
+// can't be read are skipped.
+func (w *dirWatcher) addRecursive(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if path == root {
+				return w.Add(path)
+			}
+			return nil
+		}
+		if path != root && w.excluded(path, true) {
+			return filepath.SkipDir
+		}
+		if w.opts.GitIgnore {
+			w.ignores[path] = loadGitignore(path, w.ignores[filepath.Dir(path)])
+		}
+		return w.Add(path)
+	})
+}
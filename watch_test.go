@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchSkipsExcludedDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":             "build/\n",
+		"src/a.go":               "x",
+		"src/build/out":          "x",
+		"node_modules/pkg/index": "x",
+		".cache/blob":            "x",
+	})
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	w := &dirWatcher{
+		Watcher: watcher,
+		opts:    &ScanOptions{Exclude: []string{"node_modules"}, SkipHidden: true, GitIgnore: true},
+		ignores: make(map[string]*gitignore),
+	}
+	if err := w.addRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got := watcher.WatchList()
+	slices.Sort(got)
+	want := []string{dir, filepath.Join(dir, "src")}
+	if !slices.Equal(got, want) {
+		t.Errorf("watching %v, want %v", got, want)
+	}
+	if !w.excluded(filepath.Join(dir, "src", "build"), true) {
+		t.Errorf("a gitignored directory created later should be left out")
+	}
+}
+
+func TestWatchIgnoresOwnOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stopping the watch needs SIGINT")
+	}
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.txt")
+
+	var renders atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- watchDirs([]string{dir}, &ScanOptions{}, []string{output}, func() {
+			renders.Add(1)
+			if err := os.WriteFile(output, []byte(time.Now().String()), 0644); err != nil {
+				t.Error(err)
+			}
+		})
+	}()
+
+	// Keep changing the tree until the watch is set up and redraws once
+	for i := 0; renders.Load() == 0; i++ {
+		if i == 10 {
+			t.Fatal("no redraw after changing the watched directory")
+		}
+		if err := os.WriteFile(filepath.Join(dir, "trigger"), []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * watchDebounce)
+	}
+	before := renders.Load()
+	time.Sleep(4 * watchDebounce)
+	// One more is fine, for a trigger write that was still pending
+	if after := renders.Load(); after > before+1 {
+		t.Errorf("redrew %d more times after writing its own output", after-before)
+	}
+
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := self.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}